@@ -4,18 +4,35 @@ import (
 	_ "embed"
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/tb0hdan/memcache"
+	"github.com/tb0hdan/pdns-sensor/pkg/cache"
 	"github.com/tb0hdan/pdns-sensor/pkg/clients/domainsproject"
 	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/privacy"
+	"github.com/tb0hdan/pdns-sensor/pkg/rules"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/accesslog"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/adguard"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/coredns"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/dnsmasq"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/dnsproxy"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/doh"
 	miktortik_log "github.com/tb0hdan/pdns-sensor/pkg/sources/miktortik-log"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources/pcap"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/pipe"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/regexlog"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/sshdump"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources/subfinder"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/suricata"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources/tcpdump"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/zeek"
 	"github.com/tb0hdan/pdns-sensor/pkg/submitter"
 	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+	"github.com/weppos/publicsuffix-go/publicsuffix"
 )
 
 //go:embed VERSION
@@ -27,9 +44,83 @@ func main() {
 		enableMikrotik  = flag.Bool("enable-mikrotik", false, "Enable Mikrotik log source")
 		enableTCPDump   = flag.Bool("enable-tcpdump", false, "Enable TCPDump source")
 		enablePCAP      = flag.Bool("enable-pcap", false, "Enable PCAP source")
+		pcapSNI         = flag.Bool("pcap-sni", false, "Also extract hostnames from TLS and QUIC SNI in the PCAP source")
+		pcapHTTP        = flag.Bool("pcap-http", false, "Also extract hostnames from plaintext HTTP requests in the PCAP source")
+		pcapInterfaces  = flag.String("pcap-interfaces", pcap.DefaultInterface, "Comma separated interfaces for the PCAP source")
+		pcapBPF         = flag.String("pcap-bpf", "", "Custom BPF filter for the PCAP source, replaces the one built from the other -pcap options")
+		pcapSnapLen     = flag.Int("pcap-snaplen", pcap.DefaultSnapLen, "Maximum bytes captured per packet by the PCAP source")
+		pcapPromisc     = flag.Bool("pcap-promisc", true, "Put the PCAP source interfaces into promiscuous mode")
+		pcapBufferSize  = flag.Int("pcap-buffer-size", 0, "Kernel capture buffer size in KiB for the PCAP source, 0 for the libpcap default")
+		pcapImmediate   = flag.Bool("pcap-immediate", false, "Deliver packets to the PCAP source immediately instead of batching them")
+		pcapStats       = flag.Duration("pcap-stats-interval", pcap.DefaultStatsInterval, "How often the PCAP source logs capture and drop counters")
+		tcpdumpIfaces   = flag.String("tcpdump-interfaces", tcpdump.DefaultInterface, "Comma separated interfaces for the TCPDump source")
+		tcpdumpBPF      = flag.String("tcpdump-bpf", tcpdump.DefaultFilter, "BPF filter for the TCPDump source")
+		tcpdumpSnapLen  = flag.Int("tcpdump-snaplen", 0, "Maximum bytes captured per packet by the TCPDump source, 0 for the tcpdump default")
+		tcpdumpPromisc  = flag.Bool("tcpdump-promisc", true, "Put the TCPDump source interfaces into promiscuous mode")
+		tcpdumpBuffer   = flag.Int("tcpdump-buffer-size", 0, "Kernel capture buffer size in KiB for the TCPDump source, 0 for the tcpdump default")
+		tcpdumpImmed    = flag.Bool("tcpdump-immediate", false, "Deliver packets to the TCPDump source immediately instead of batching them")
+		tcpdumpTunnels  = flag.Bool("tcpdump-tunnels", false, "Also capture VLAN tagged and VXLAN/GENEVE/GRE/ERSPAN encapsulated traffic in the TCPDump source")
+		pcapLocal       = flag.Bool("pcap-local", false, "Also capture mDNS, LLMNR and NetBIOS-NS in the PCAP source, local names are counted and logged")
+		pcapDNSPorts    = flag.String("pcap-dns-ports", "", "Comma separated extra DNS ports for the PCAP source, e.g. 5053 for dnscrypt-proxy")
+		pcapTunnels     = flag.Bool("pcap-tunnels", false, "Also capture VLAN tagged and VXLAN/GENEVE/GRE/ERSPAN encapsulated traffic in the PCAP source")
 		enableSubfinder = flag.Bool("enable-subfinder", false, "Enable Subfinder source for subdomain discovery")
+		enableDnsmasq   = flag.Bool("enable-dnsmasq", false, "Enable dnsmasq/Pi-hole log source")
+		enableZeek      = flag.Bool("enable-zeek", false, "Enable Zeek dns.log source")
+		enableSuricata  = flag.Bool("enable-suricata", false, "Enable Suricata eve.json source")
+		enableAdGuard   = flag.Bool("enable-adguard", false, "Enable AdGuard Home querylog.json source")
+		enableCoreDNS   = flag.Bool("enable-coredns", false, "Enable CoreDNS log plugin source")
+		enableRegex     = flag.Bool("enable-regex", false, "Enable generic regex/grok log source")
+		enableDNSProxy  = flag.Bool("enable-dns-proxy", false, "Enable built-in forwarding DNS proxy source")
+		enableDoH       = flag.Bool("enable-doh", false, "Enable DNS-over-HTTPS (RFC 8484) endpoint source")
+		enablePipe      = flag.Bool("enable-pipe", false, "Enable stdin/named pipe source for domain lists and JSON observations")
+		enableSSHDump   = flag.Bool("enable-ssh-dump", false, "Enable remote tcpdump over SSH source")
+		enableAccessLog = flag.Bool("enable-access-log", false, "Enable Squid/nginx/HAProxy forward proxy access log source")
 		mikrotikLogFile = flag.String("mikrotik-log-file", miktortik_log.DefaultLogFile, "Path to the Mikrotik log file")
+		dnsmasqLogFile  = flag.String("dnsmasq-log-file", dnsmasq.DefaultLogFile, "Path to the dnsmasq/Pi-hole log file")
+		zeekLogFile     = flag.String("zeek-log-file", zeek.DefaultLogFile, "Path to the Zeek dns.log file (TSV or JSON)")
+		suricataLogFile = flag.String("suricata-log-file", suricata.DefaultLogFile, "Path to the Suricata eve.json file")
+		adGuardLogFile  = flag.String("adguard-log-file", adguard.DefaultLogFile, "Path to the AdGuard Home querylog.json file")
+		coreDNSLogFile  = flag.String("coredns-log-file", coredns.DefaultLogFile, "Path to the CoreDNS log file")
+		pipePath        = flag.String("pipe-path", pipe.Stdin, "Named pipe or file for the pipe source, - for stdin")
+		sshTargets      = flag.String("ssh-targets", "", "Comma separated [user@]host[:port] targets for the SSH capture source")
+		sshKey          = flag.String("ssh-key", "", "Private key for the SSH capture source (default ~/.ssh/id_ed25519)")
+		sshKnownHosts   = flag.String("ssh-known-hosts", "", "known_hosts file verifying SSH targets (default ~/.ssh/known_hosts)")
+		sshCommand      = flag.String("ssh-command", sshdump.DefaultCommand, "Command run on SSH targets, must write a pcap stream to stdout")
+		sshTunnels      = flag.Bool("ssh-tunnels", false, "Also capture VLAN tagged and encapsulated traffic on SSH targets, default -ssh-command only")
+		accessLogFile   = flag.String("access-log-file", accesslog.DefaultLogFile, "Path to the forward proxy access log file")
+		regexLogFile    = flag.String("regex-log-file", "", "Path to the log file for the regex source")
+		regexPattern    = flag.String("regex-pattern", "", "Regex or grok pattern with a qname and optional qtype/client/ts groups")
+		regexFilter     = flag.String("regex-filter", "", "Only apply regex-pattern to lines containing this substring")
+		dnsProxyListen  = flag.String("dns-proxy-listen", dnsproxy.DefaultListenAddr, "UDP and TCP address for the DNS proxy to listen on")
+		dnsUpstreams    = flag.String("dns-upstreams", "1.1.1.1,8.8.8.8", "Comma separated upstream resolvers for the DNS proxy and DoH")
+		dohListen       = flag.String("doh-listen", doh.DefaultListenAddr, "Address for the DoH endpoint to listen on")
+		dohPath         = flag.String("doh-path", doh.DefaultPath, "URL path of the DoH endpoint")
+		dohTLSCert      = flag.String("doh-tls-cert", "", "TLS certificate for the DoH endpoint, plain HTTP if empty")
+		dohTLSKey       = flag.String("doh-tls-key", "", "TLS key for the DoH endpoint")
 		cacheTTL        = flag.Int64("cache-ttl", 3600, "Cache TTL in seconds (default: 3600 seconds)")
+		cacheFile       = flag.String("cache-file", "", "Snapshot file keeping the dedupe cache across restarts, in-memory only if empty")
+		cacheSnapshot   = flag.Duration("cache-snapshot-interval", cache.DefaultSnapshotInterval, "How often the dedupe cache is saved to -cache-file")
+		cacheBloom      = flag.Bool("cache-bloom", false, "Use rotating Bloom filters for the dedupe cache, bounded memory at the cost of false positives")
+		bloomCapacity   = flag.Int("cache-bloom-capacity", cache.DefaultBloomCapacity, "Distinct domains expected per -cache-ttl with -cache-bloom")
+		bloomFPRate     = flag.Float64("cache-bloom-fp-rate", cache.DefaultBloomFalsePositiveRate, "Chance that -cache-bloom skips a domain it never saw")
+		submitUnicode   = flag.Bool("submit-unicode", false, "Submit internationalized domains in their Unicode form as well as the xn-- form")
+		pslFilter       = flag.Bool("psl-filter", false, "Drop names whose suffix isn't in the Public Suffix List and bare public suffixes")
+		pslFile         = flag.String("psl-file", "", "Public Suffix List file to use instead of the built-in one, implies -psl-filter")
+		registeredOnly  = flag.Bool("registered-domains", false, "Submit only registered domains (eTLD+1), implies -psl-filter")
+		denyFile        = flag.String("deny-file", "", "File of names, wildcards, regexes and client networks never to submit, reloaded on change")
+		allowFile       = flag.String("allow-file", "", "File of names, wildcards, regexes and client networks to submit exclusively, reloaded on change")
+		denySpecialUse  = flag.Bool("deny-special-use", true, "Never submit IANA special-use names like .test, .local, .home.arpa and reverse lookups")
+		rulesReload     = flag.Duration("rules-reload-interval", rules.DefaultReloadInterval, "How often -deny-file and -allow-file are checked for changes")
+		privacyStrip    = flag.String("privacy-strip", "", "Comma separated zone:count pairs, drop up to count leftmost labels below zone, e.g. avqs.mcafee.com:4")
+		privacyRedact   = flag.String("privacy-redact", "", "Comma separated detectors replacing matching labels with a placeholder: hash, uuid, email, entropy")
+		privacyHolder   = flag.String("privacy-placeholder", privacy.DefaultPlaceholder, "Label that replaces the ones matched by -privacy-redact")
+		privacyHMAC     = flag.String("privacy-hmac-zones", "", "Comma separated zones whose subdomains are replaced by a keyed hash, requires -privacy-hmac-key-file")
+		privacyKeyFile  = flag.String("privacy-hmac-key-file", "", "File with the secret key, at least 16 bytes, for -privacy-hmac-zones")
+		pipelineStages  = flag.String("pipeline", strings.Join(models.DefaultPipeline, ","), "Comma separated order of the stages names go through before the queue, stages left out don't run")
+		queueMaxSize    = flag.Int("queue-max-size", 0, "Maximum number of domains queued between submissions, 0 for unbounded")
+		queueOverflow   = flag.String("queue-overflow", string(models.DropNewest), "What to do when the queue is full: drop-newest, drop-oldest, spill-to-disk or block-with-timeout")
+		queueSpillFile  = flag.String("queue-spill-file", "", "File domains are spilled to with -queue-overflow spill-to-disk")
+		queueBlockWait  = flag.Duration("queue-block-timeout", models.DefaultBlockTimeout, "How long sources wait for room with -queue-overflow block-with-timeout")
 		version         = flag.Bool("version", false, "Print version and exit")
 	)
 	flag.Parse()
@@ -37,7 +128,10 @@ func main() {
 		println("pdns-sensor version:", Version)
 		os.Exit(0)
 	}
-	if !*enableMikrotik && !*enableTCPDump && !*enablePCAP && !*enableSubfinder {
+	if !*enableMikrotik && !*enableTCPDump && !*enablePCAP && !*enableSubfinder && !*enableDnsmasq &&
+		!*enableZeek && !*enableSuricata && !*enableAdGuard && !*enableCoreDNS &&
+		!*enableRegex && !*enableDNSProxy && !*enableDoH && !*enableAccessLog && !*enableSSHDump &&
+		!*enablePipe {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -49,14 +143,127 @@ func main() {
 	}
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 	wrapLogger := utils.WrapLogger(logger)
-	cache := memcache.New(wrapLogger)
-	queue := models.NewDomainQueue(cache, *cacheTTL)
+	var (
+		domainCache     models.CacheInterface
+		persistentCache *cache.Persistent
+	)
+	switch {
+	case *cacheBloom && *cacheFile != "":
+		logger.Fatal().Msg("-cache-bloom and -cache-file can't be used together")
+	case *cacheBloom:
+		bloom, err := cache.NewBloom(cache.BloomConfig{
+			TTL:               time.Duration(*cacheTTL) * time.Second,
+			Capacity:          *bloomCapacity,
+			FalsePositiveRate: *bloomFPRate,
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create Bloom filter cache")
+		}
+		logger.Info().Int("bytes", bloom.SizeBytes()).Msg("Using Bloom filter cache")
+		domainCache = bloom
+	case *cacheFile != "":
+		var err error
+		if persistentCache, err = cache.NewPersistent(*cacheFile, *cacheSnapshot, logger); err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load cache")
+		}
+		domainCache = persistentCache
+		go func() {
+			if err := persistentCache.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start cache snapshots")
+			}
+		}()
+	default:
+		domainCache = memcache.New(wrapLogger)
+	}
+	overflowPolicy, err := models.ParseOverflowPolicy(*queueOverflow)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid queue overflow policy")
+	}
+	if overflowPolicy == models.SpillToDisk && *queueSpillFile == "" {
+		logger.Fatal().Msg("-queue-spill-file is required with -queue-overflow spill-to-disk")
+	}
+	queueOptions := []models.QueueOption{
+		models.WithMaxSize(*queueMaxSize),
+		models.WithOverflowPolicy(overflowPolicy),
+		models.WithBlockTimeout(*queueBlockWait),
+	}
+	stages, err := models.ParsePipeline(*pipelineStages)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid -pipeline")
+	}
+	queueOptions = append(queueOptions, models.WithPipeline(stages...))
+	if *queueSpillFile != "" {
+		queueOptions = append(queueOptions, models.WithSpillFile(*queueSpillFile))
+	}
+	if *submitUnicode {
+		queueOptions = append(queueOptions, models.WithUnicodeForm())
+	}
+	switch {
+	case *pslFile != "":
+		list, err := models.LoadPublicSuffixList(*pslFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load Public Suffix List")
+		}
+		logger.Info().Int("rules", list.Size()).Str("path", *pslFile).Msg("Loaded Public Suffix List")
+		queueOptions = append(queueOptions, models.WithPublicSuffixList(list))
+	case *pslFilter:
+		queueOptions = append(queueOptions, models.WithPublicSuffixList(publicsuffix.DefaultList))
+	}
+	if *registeredOnly {
+		queueOptions = append(queueOptions, models.WithRegisteredDomains())
+	}
+	if *privacyStrip != "" || *privacyRedact != "" || *privacyHMAC != "" {
+		privacyConfig := privacy.Config{Placeholder: *privacyHolder}
+		if privacyConfig.Strip, err = privacy.ParseStrip(*privacyStrip); err != nil {
+			logger.Fatal().Err(err).Msg("Invalid -privacy-strip")
+		}
+		if privacyConfig.Detectors, err = privacy.ParseDetectors(*privacyRedact); err != nil {
+			logger.Fatal().Err(err).Msg("Invalid -privacy-redact")
+		}
+		if *privacyHMAC != "" {
+			privacyConfig.HMACZones = strings.Split(*privacyHMAC, ",")
+			if privacyConfig.HMACKey, err = privacy.LoadKey(*privacyKeyFile); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to load -privacy-hmac-key-file")
+			}
+		}
+		transformer, err := privacy.New(privacyConfig)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid privacy settings")
+		}
+		queueOptions = append(queueOptions, models.WithTransformer(transformer))
+	}
+	var filter *rules.Filter
+	if *denyFile != "" || *allowFile != "" || *denySpecialUse {
+		if filter, err = rules.NewFilter(rules.Config{
+			DenyFile:       *denyFile,
+			AllowFile:      *allowFile,
+			SpecialUse:     *denySpecialUse,
+			ReloadInterval: *rulesReload,
+		}, logger); err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load rules")
+		}
+		queueOptions = append(queueOptions, models.WithNameFilter(filter))
+		go func() {
+			if err := filter.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start rules reloading")
+			}
+		}()
+	}
+	queue := models.NewDomainQueue(domainCache, *cacheTTL, queueOptions...)
 	// Initialize the queue newSubmitter
 	client := domainsproject.NewDomainsProjectClient("", logger) // Use default API URL
 	newSubmitter := submitter.NewSubmitter(client, logger)
 	// Start the queue newSubmitter in a separate goroutine
 	go newSubmitter.QueueSubmitter(queue)
-	dumper := tcpdump.NewTCPDump(queue, logger)
+	dumper := tcpdump.NewTCPDump(queue, logger, tcpdump.Config{
+		Interfaces:  strings.Split(*tcpdumpIfaces, ","),
+		BPF:         *tcpdumpBPF,
+		SnapLen:     *tcpdumpSnapLen,
+		Promiscuous: *tcpdumpPromisc,
+		BufferSize:  *tcpdumpBuffer,
+		Immediate:   *tcpdumpImmed,
+		Tunnels:     *tcpdumpTunnels,
+	})
 	if *enableTCPDump {
 		go func() {
 			if err := dumper.Start(); err != nil {
@@ -73,8 +280,143 @@ func main() {
 			}
 		}()
 	}
+	newDnsmasq := dnsmasq.NewDnsmasqLog(queue, logger, *dnsmasqLogFile)
+	if *enableDnsmasq {
+		go func() {
+			if err := newDnsmasq.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start dnsmasq source")
+			}
+		}()
+	}
+
+	newZeek := zeek.NewZeekLog(queue, logger, *zeekLogFile)
+	if *enableZeek {
+		go func() {
+			if err := newZeek.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start Zeek source")
+			}
+		}()
+	}
+
+	newSuricata := suricata.NewSuricataLog(queue, logger, *suricataLogFile)
+	if *enableSuricata {
+		go func() {
+			if err := newSuricata.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start Suricata source")
+			}
+		}()
+	}
+
+	newAdGuard := adguard.NewAdGuardLog(queue, logger, *adGuardLogFile)
+	if *enableAdGuard {
+		go func() {
+			if err := newAdGuard.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start AdGuard Home source")
+			}
+		}()
+	}
+
+	newCoreDNS := coredns.NewCoreDNSLog(queue, logger, *coreDNSLogFile)
+	if *enableCoreDNS {
+		go func() {
+			if err := newCoreDNS.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start CoreDNS source")
+			}
+		}()
+	}
+
+	newAccessLog := accesslog.NewAccessLog(queue, logger, *accessLogFile)
+	if *enableAccessLog {
+		go func() {
+			if err := newAccessLog.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start proxy access log source")
+			}
+		}()
+	}
+
+	newPipe := pipe.NewPipe(queue, logger, *pipePath)
+	if *enablePipe {
+		go func() {
+			if err := newPipe.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start pipe source")
+			}
+		}()
+	}
+
+	forwarder := dnsproxy.NewForwarder(strings.Split(*dnsUpstreams, ","), dnsproxy.DefaultUpstreamTimeout)
+	newDNSProxy := dnsproxy.NewDNSProxy(queue, logger, *dnsProxyListen, forwarder)
+	if *enableDNSProxy {
+		go func() {
+			if err := newDNSProxy.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start DNS proxy source")
+			}
+		}()
+	}
+
+	newDoH := doh.NewDoH(queue, logger, *dohListen, *dohPath, *dohTLSCert, *dohTLSKey, forwarder)
+	if *enableDoH {
+		go func() {
+			if err := newDoH.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start DoH source")
+			}
+		}()
+	}
+
+	sourceList := []sources.Source{dumper, newMikrotik, newDnsmasq, newZeek, newSuricata, newAdGuard, newCoreDNS,
+		newAccessLog, newPipe, newDNSProxy, newDoH}
+	// The regex source can't be built without a valid pattern, so only create it on demand
+	if *enableRegex {
+		newRegex, err := regexlog.NewRegexLog(queue, logger, *regexLogFile, *regexPattern, *regexFilter)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create regex source")
+		}
+		sourceList = append(sourceList, newRegex)
+		go func() {
+			if err := newRegex.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start regex source")
+			}
+		}()
+	}
+
+	// The SSH source can't be built without valid targets, so only create it on demand
+	if *enableSSHDump {
+		newSSHDump, err := sshdump.NewSSHDump(queue, logger, sshdump.Config{
+			Targets:        strings.Split(*sshTargets, ","),
+			KeyFile:        *sshKey,
+			KnownHostsFile: *sshKnownHosts,
+			Command:        *sshCommand,
+			Tunnels:        *sshTunnels,
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create SSH capture source")
+		}
+		sourceList = append(sourceList, newSSHDump)
+		go func() {
+			if err := newSSHDump.Start(); err != nil {
+				logger.Fatal().Err(err).Msg("Failed to start SSH capture source")
+			}
+		}()
+	}
+
 	// If PCAP is enabled, create a new PCAP source
-	pcapSource := pcap.NewPCAP(queue, logger)
+	dnsPorts, err := utils.ParsePorts(*pcapDNSPorts)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid -pcap-dns-ports")
+	}
+	pcapSource := pcap.NewPCAP(queue, logger, pcap.Config{
+		Interfaces:    strings.Split(*pcapInterfaces, ","),
+		BPF:           *pcapBPF,
+		SnapLen:       *pcapSnapLen,
+		Promiscuous:   *pcapPromisc,
+		BufferSize:    *pcapBufferSize,
+		Immediate:     *pcapImmediate,
+		StatsInterval: *pcapStats,
+		SNI:           *pcapSNI,
+		HTTP:          *pcapHTTP,
+		Local:         *pcapLocal,
+		Ports:         dnsPorts,
+		Tunnels:       *pcapTunnels,
+	})
 	if *enablePCAP {
 		go func() {
 			if err := pcapSource.Start(); err != nil {
@@ -93,6 +435,14 @@ func main() {
 		}()
 	}
 
+	sourceList = append(sourceList, pcapSource, subfinderSource)
+	if filter != nil {
+		sourceList = append(sourceList, filter)
+	}
+	if persistentCache != nil {
+		// Stopped last, so the snapshot includes everything the sources added while stopping
+		sourceList = append(sourceList, persistentCache)
+	}
 	// Run the main loop
-	utils.Run(logger, []sources.Source{dumper, newMikrotik, pcapSource, subfinderSource})
+	utils.Run(logger, sourceList)
 }
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"errors"
+	"hash/maphash"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultBloomGenerations       = 4
+	DefaultBloomFalsePositiveRate = 0.001
+	DefaultBloomCapacity          = 1000000
+)
+
+type BloomConfig struct {
+	TTL               time.Duration // How long a key is remembered, at least TTL*(Generations-1)/Generations
+	Capacity          int           // Distinct keys expected per TTL, more shortens the TTL instead of raising the FP rate
+	FalsePositiveRate float64       // Chance that Get reports a key that was never set
+	Generations       int           // Number of filters the TTL is sliced into, more rotates away less at a time
+}
+
+// bloomFilter is one generation, its bits are set atomically so concurrent SetEx only need a read lock.
+type bloomFilter struct {
+	bits  []atomic.Uint64
+	count atomic.Int64
+}
+
+// Bloom is a memory-bounded dedupe cache made of time-sliced rotating Bloom filters.
+// Keys are added to the newest filter and looked up in all of them, the oldest filter is
+// dropped every TTL/Generations, or earlier once the newest is full. It satisfies
+// models.CacheInterface, but stores no values and ignores per-key TTLs: Get returns true
+// for every key that was probably set within the TTL.
+type Bloom struct {
+	lock         sync.RWMutex
+	filters      []*bloomFilter // Oldest first
+	bits         uint64         // Bits per filter
+	hashes       int            // Hash functions per filter
+	capacity     int64          // Keys per filter
+	slice        time.Duration
+	nextRotation atomic.Int64 // Unix nanoseconds
+	seeds        [2]maphash.Seed
+	now          func() time.Time
+}
+
+// bloomSize returns the bits and hash functions for a filter of n keys at false positive rate p.
+func bloomSize(n int64, p float64) (uint64, int) {
+	bits := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	hashes := int(math.Round(bits / float64(n) * math.Ln2))
+	return uint64(max(bits, 64)), max(hashes, 1)
+}
+
+// locations calls fn with the bit index of every hash function for key.
+func (b *Bloom) locations(key string, fn func(uint64) bool) bool {
+	// Kirsch-Mitzenmacher double hashing
+	h1 := maphash.String(b.seeds[0], key)
+	h2 := maphash.String(b.seeds[1], key) | 1
+	for i := 0; i < b.hashes; i++ {
+		if !fn((h1 + uint64(i)*h2) % b.bits) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bloom) newFilter() *bloomFilter {
+	return &bloomFilter{bits: make([]atomic.Uint64, (b.bits+63)/64)}
+}
+
+// rotate drops the oldest filter and starts a new one, the caller holds the write lock.
+func (b *Bloom) rotate(now time.Time) {
+	copy(b.filters, b.filters[1:])
+	b.filters[len(b.filters)-1] = b.newFilter()
+	b.nextRotation.Store(now.Add(b.slice).UnixNano())
+}
+
+// expire rotates away every filter whose time slice has passed.
+func (b *Bloom) expire() {
+	now := b.now()
+	if now.UnixNano() < b.nextRotation.Load() {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i := 0; i < len(b.filters) && now.UnixNano() >= b.nextRotation.Load(); i++ {
+		b.rotate(time.Unix(0, b.nextRotation.Load()))
+	}
+	if now.UnixNano() >= b.nextRotation.Load() {
+		// Idle for longer than the TTL, every filter is already empty
+		b.nextRotation.Store(now.Add(b.slice).UnixNano())
+	}
+}
+
+func (b *Bloom) Get(key string) (value interface{}, ok bool) {
+	b.expire()
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for i := len(b.filters) - 1; i >= 0; i-- {
+		filter := b.filters[i]
+		if filter.count.Load() == 0 {
+			continue
+		}
+		if b.locations(key, func(bit uint64) bool {
+			return filter.bits[bit/64].Load()&(1<<(bit%64)) != 0
+		}) {
+			return true, true
+		}
+	}
+	return nil, false
+}
+
+// SetEx adds key to the newest filter, value and expires are ignored.
+func (b *Bloom) SetEx(key string, _ interface{}, _ int64) {
+	b.expire()
+	b.lock.RLock()
+	filter := b.filters[len(b.filters)-1]
+	b.locations(key, func(bit uint64) bool {
+		filter.bits[bit/64].Or(1 << (bit % 64))
+		return true
+	})
+	full := filter.count.Add(1) >= b.capacity
+	b.lock.RUnlock()
+	if full {
+		b.lock.Lock()
+		// Another SetEx may have rotated already
+		if b.filters[len(b.filters)-1] == filter {
+			b.rotate(b.now())
+		}
+		b.lock.Unlock()
+	}
+}
+
+// SizeBytes returns the memory used by the filter bits.
+func (b *Bloom) SizeBytes() int {
+	return len(b.filters) * int((b.bits+63)/64) * 8
+}
+
+func NewBloom(config BloomConfig) (*Bloom, error) {
+	return newBloom(config, time.Now)
+}
+
+func newBloom(config BloomConfig, now func() time.Time) (*Bloom, error) {
+	if config.Generations == 0 {
+		config.Generations = DefaultBloomGenerations
+	}
+	if config.FalsePositiveRate == 0 {
+		config.FalsePositiveRate = DefaultBloomFalsePositiveRate
+	}
+	if config.Capacity == 0 {
+		config.Capacity = DefaultBloomCapacity
+	}
+	switch {
+	case config.TTL <= 0:
+		return nil, errors.New("bloom filter TTL must be positive")
+	case config.Generations < 2:
+		return nil, errors.New("bloom filter needs at least 2 generations")
+	case config.Capacity < 0:
+		return nil, errors.New("bloom filter capacity must be positive")
+	case config.FalsePositiveRate <= 0 || config.FalsePositiveRate >= 1:
+		return nil, errors.New("bloom filter false positive rate must be between 0 and 1")
+	}
+	capacity := max(int64(config.Capacity/config.Generations), 1)
+	// A lookup checks every generation, so each gets a share of the false positive rate
+	bits, hashes := bloomSize(capacity, config.FalsePositiveRate/float64(config.Generations))
+	b := &Bloom{
+		filters:  make([]*bloomFilter, config.Generations),
+		bits:     bits,
+		hashes:   hashes,
+		capacity: capacity,
+		slice:    config.TTL / time.Duration(config.Generations),
+		seeds:    [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()},
+		now:      now,
+	}
+	for i := range b.filters {
+		b.filters[i] = b.newFilter()
+	}
+	b.nextRotation.Store(now().Add(b.slice).UnixNano())
+	return b, nil
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+)
+
+var (
+	_ models.CacheInterface = (*Bloom)(nil)
+	_ models.CacheInterface = (*Persistent)(nil)
+)
+
+type BloomTestSuite struct {
+	suite.Suite
+	clock time.Time
+}
+
+func (suite *BloomTestSuite) SetupTest() {
+	suite.clock = time.Unix(1700000000, 0)
+}
+
+func (suite *BloomTestSuite) newBloom(config BloomConfig) *Bloom {
+	b, err := newBloom(config, func() time.Time { return suite.clock })
+	suite.Require().NoError(err)
+	return b
+}
+
+func (suite *BloomTestSuite) TestNoFalseNegatives() {
+	b := suite.newBloom(BloomConfig{TTL: time.Hour, Capacity: 40000})
+	for i := 0; i < 10000; i++ {
+		b.SetEx(fmt.Sprintf("host%d.example.com", i), true, 3600)
+	}
+	for i := 0; i < 10000; i++ {
+		value, ok := b.Get(fmt.Sprintf("host%d.example.com", i))
+		suite.Require().True(ok)
+		suite.Equal(true, value)
+	}
+}
+
+func (suite *BloomTestSuite) TestFalsePositiveRate() {
+	const rate = 0.01
+	b := suite.newBloom(BloomConfig{TTL: time.Hour, Capacity: 40000, FalsePositiveRate: rate})
+	// Fill every generation to capacity, the worst case for lookups
+	for i := 0; i < 40000; i++ {
+		if i > 0 && i%10000 == 0 {
+			suite.clock = suite.clock.Add(15 * time.Minute)
+		}
+		b.SetEx(fmt.Sprintf("host%d.example.com", i), true, 3600)
+	}
+	falsePositives := 0
+	for i := 0; i < 100000; i++ {
+		if _, ok := b.Get(fmt.Sprintf("other%d.example.net", i)); ok {
+			falsePositives++
+		}
+	}
+	suite.Less(float64(falsePositives)/100000, rate*1.5)
+}
+
+func (suite *BloomTestSuite) TestRotation() {
+	b := suite.newBloom(BloomConfig{TTL: time.Hour, Generations: 4})
+	b.SetEx("example.com", true, 3600)
+
+	// A key set at the start of a slice lives for the whole TTL
+	suite.clock = suite.clock.Add(time.Hour - time.Second)
+	_, ok := b.Get("example.com")
+	suite.True(ok)
+	b.SetEx("www.example.com", true, 3600)
+	suite.clock = suite.clock.Add(time.Second)
+	_, ok = b.Get("example.com")
+	suite.False(ok)
+
+	// One set at the end of a slice lives for at least TTL*(Generations-1)/Generations
+	suite.clock = suite.clock.Add(45*time.Minute - time.Second)
+	_, ok = b.Get("www.example.com")
+	suite.True(ok)
+	suite.clock = suite.clock.Add(time.Second)
+	_, ok = b.Get("www.example.com")
+	suite.False(ok)
+}
+
+func (suite *BloomTestSuite) TestIdleLongerThanTTL() {
+	b := suite.newBloom(BloomConfig{TTL: time.Hour})
+	b.SetEx("example.com", true, 3600)
+	suite.clock = suite.clock.Add(10 * time.Hour)
+	_, ok := b.Get("example.com")
+	suite.False(ok)
+
+	// Rotation restarts from now, not from where it left off
+	b.SetEx("example.com", true, 3600)
+	suite.clock = suite.clock.Add(45 * time.Minute)
+	_, ok = b.Get("example.com")
+	suite.True(ok)
+}
+
+func (suite *BloomTestSuite) TestRotatesEarlyWhenFull() {
+	b := suite.newBloom(BloomConfig{TTL: time.Hour, Capacity: 20, Generations: 2, FalsePositiveRate: 1e-9})
+	for i := 0; i < 25; i++ {
+		b.SetEx(fmt.Sprintf("host%d.example.com", i), true, 3600)
+	}
+	// Ten keys per generation, the first ten were rotated away without waiting for the TTL
+	for i := 0; i < 25; i++ {
+		_, ok := b.Get(fmt.Sprintf("host%d.example.com", i))
+		suite.Equal(i >= 10, ok, "host%d", i)
+	}
+}
+
+func (suite *BloomTestSuite) TestSizeBytes() {
+	b := suite.newBloom(BloomConfig{TTL: time.Hour, Capacity: 1000000, FalsePositiveRate: 0.001})
+	// About 17 bits per key at 0.025% per generation, a fraction of storing the names
+	suite.InDelta(2200000, b.SizeBytes(), 100000)
+}
+
+func (suite *BloomTestSuite) TestInvalidConfig() {
+	for _, config := range []BloomConfig{
+		{},
+		{TTL: time.Hour, Generations: 1},
+		{TTL: time.Hour, Capacity: -1},
+		{TTL: time.Hour, FalsePositiveRate: 1},
+		{TTL: time.Hour, FalsePositiveRate: -0.1},
+	} {
+		_, err := NewBloom(config)
+		suite.Error(err, "%+v", config)
+	}
+}
+
+func (suite *BloomTestSuite) TestDomainQueue() {
+	b := suite.newBloom(BloomConfig{TTL: time.Hour})
+	queue := models.NewDomainQueue(b, 3600)
+	queue.Add("example.com")
+	suite.Equal([]string{"example.com"}, queue.Get())
+	queue.Add("example.com")
+	suite.Empty(queue.Get())
+}
+
+func TestBloomTestSuite(t *testing.T) {
+	suite.Run(t, new(BloomTestSuite))
+}
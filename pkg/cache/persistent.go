@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultSnapshotInterval = 5 * time.Minute
+	// maxSnapshotLine bounds a single snapshot entry, far above any domain name.
+	maxSnapshotLine = 64 * 1024
+)
+
+type entry struct {
+	value   interface{}
+	expires int64 // Unix seconds, 0 never expires
+}
+
+// snapshotEntry is one line of the snapshot file. Values are stored as JSON, so they
+// come back as encoding/json decodes them, true stays true.
+type snapshotEntry struct {
+	Key     string      `json:"key"`
+	Value   interface{} `json:"value"`
+	Expires int64       `json:"expires,omitempty"`
+}
+
+// Persistent is a TTL cache that is loaded from a snapshot file on start and written back
+// periodically and on shutdown, so restarts don't resubmit every domain seen within the TTL.
+// It satisfies models.CacheInterface and sources.Source, Start runs the snapshot loop.
+type Persistent struct {
+	lock     sync.RWMutex
+	entries  map[string]entry
+	path     string
+	interval time.Duration
+	logger   zerolog.Logger
+	now      func() time.Time
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func (p *Persistent) expired(e entry, now int64) bool {
+	return e.expires != 0 && e.expires <= now
+}
+
+func (p *Persistent) Get(key string) (value interface{}, ok bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	e, ok := p.entries[key]
+	if !ok || p.expired(e, p.now().Unix()) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// SetEx stores value for expires seconds, 0 keeps it forever.
+func (p *Persistent) SetEx(key string, value interface{}, expires int64) {
+	if expires > 0 {
+		expires += p.now().Unix()
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.entries[key] = entry{value: value, expires: expires}
+}
+
+func (p *Persistent) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.entries)
+}
+
+// Evict removes expired entries and returns how many were removed.
+func (p *Persistent) Evict() int {
+	now := p.now().Unix()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	evicted := 0
+	for key, e := range p.entries {
+		if p.expired(e, now) {
+			delete(p.entries, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Load adds the unexpired entries of the snapshot file, a missing file is not an error.
+func (p *Persistent) Load() error {
+	file, err := os.Open(p.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	now := p.now().Unix()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), maxSnapshotLine)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for line := 1; scanner.Scan(); line++ {
+		var s snapshotEntry
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return fmt.Errorf("%s:%d: %w", p.path, line, err)
+		}
+		if e := (entry{value: s.Value, expires: s.Expires}); !p.expired(e, now) {
+			p.entries[s.Key] = e
+		}
+	}
+	return scanner.Err()
+}
+
+// Save writes the unexpired entries to the snapshot file. It writes a temporary file next to it
+// and renames it over, so a crash never leaves a truncated snapshot.
+func (p *Persistent) Save() error {
+	now := p.now().Unix()
+	p.lock.RLock()
+	snapshot := make([]snapshotEntry, 0, len(p.entries))
+	for key, e := range p.entries {
+		if !p.expired(e, now) {
+			snapshot = append(snapshot, snapshotEntry{Key: key, Value: e.value, Expires: e.expires})
+		}
+	}
+	p.lock.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name()) // Already renamed on success
+	}()
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, s := range snapshot {
+		if err = encoder.Encode(s); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
+
+// Start evicts expired entries and saves a snapshot every interval until Stop is called.
+func (p *Persistent) Start() error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return nil
+		case <-ticker.C:
+			evicted := p.Evict()
+			if err := p.Save(); err != nil {
+				p.logger.Error().Err(err).Str("path", p.path).Msg("Failed to save cache snapshot")
+				continue
+			}
+			p.logger.Debug().Int("entries", p.Len()).Int("evicted", evicted).Msg("Saved cache snapshot")
+		}
+	}
+}
+
+// Stop ends the snapshot loop and saves a final snapshot.
+func (p *Persistent) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+	if err := p.Save(); err != nil {
+		return err
+	}
+	p.logger.Info().Int("entries", p.Len()).Str("path", p.path).Msg("Saved cache snapshot")
+	return nil
+}
+
+// NewPersistent creates a cache snapshotted to path every interval and loads the existing snapshot, if any.
+func NewPersistent(path string, interval time.Duration, logger zerolog.Logger) (*Persistent, error) {
+	return newPersistent(path, interval, logger, time.Now)
+}
+
+func newPersistent(path string, interval time.Duration, logger zerolog.Logger, now func() time.Time) (*Persistent, error) {
+	if interval <= 0 {
+		interval = DefaultSnapshotInterval
+	}
+	p := &Persistent{
+		entries:  make(map[string]entry),
+		path:     path,
+		interval: interval,
+		logger:   logger,
+		now:      now,
+		done:     make(chan struct{}),
+	}
+	if err := p.Load(); err != nil {
+		return nil, fmt.Errorf("loading cache snapshot: %w", err)
+	}
+	logger.Info().Int("entries", p.Len()).Str("path", path).Msg("Loaded cache snapshot")
+	return p, nil
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+)
+
+type PersistentTestSuite struct {
+	suite.Suite
+	path  string
+	clock time.Time
+	cache *Persistent
+}
+
+func (suite *PersistentTestSuite) SetupTest() {
+	suite.path = filepath.Join(suite.T().TempDir(), "cache.json")
+	suite.clock = time.Unix(1700000000, 0)
+	suite.cache = suite.open()
+}
+
+// open loads the snapshot at suite.path using the test clock.
+func (suite *PersistentTestSuite) open() *Persistent {
+	p, err := newPersistent(suite.path, time.Hour, zerolog.Nop(), func() time.Time { return suite.clock })
+	suite.Require().NoError(err)
+	return p
+}
+
+func (suite *PersistentTestSuite) TestSetExGet() {
+	suite.cache.SetEx("example.com", true, 60)
+	suite.cache.SetEx("forever.example.com", true, 0)
+
+	value, ok := suite.cache.Get("example.com")
+	suite.True(ok)
+	suite.Equal(true, value)
+	_, ok = suite.cache.Get("missing.example.com")
+	suite.False(ok)
+
+	// Expired entries are gone even before they are evicted
+	suite.clock = suite.clock.Add(time.Minute)
+	_, ok = suite.cache.Get("example.com")
+	suite.False(ok)
+	_, ok = suite.cache.Get("forever.example.com")
+	suite.True(ok)
+	suite.Equal(2, suite.cache.Len())
+	suite.Equal(1, suite.cache.Evict())
+	suite.Equal(1, suite.cache.Len())
+}
+
+func (suite *PersistentTestSuite) TestSaveLoadKeepsTTL() {
+	suite.cache.SetEx("example.com", true, 60)
+	suite.cache.SetEx("short.example.com", true, 10)
+	suite.cache.SetEx("forever.example.com", true, 0)
+	suite.Require().NoError(suite.cache.Save())
+
+	// Restart 30 seconds later, the short entry has expired and the other keeps its remaining 30 seconds
+	suite.clock = suite.clock.Add(30 * time.Second)
+	restarted := suite.open()
+	suite.Equal(2, restarted.Len())
+	_, ok := restarted.Get("short.example.com")
+	suite.False(ok)
+	value, ok := restarted.Get("example.com")
+	suite.True(ok)
+	suite.Equal(true, value)
+	suite.clock = suite.clock.Add(30 * time.Second)
+	_, ok = restarted.Get("example.com")
+	suite.False(ok)
+	_, ok = restarted.Get("forever.example.com")
+	suite.True(ok)
+}
+
+func (suite *PersistentTestSuite) TestSaveSkipsExpired() {
+	suite.cache.SetEx("example.com", true, 10)
+	suite.clock = suite.clock.Add(time.Minute)
+	suite.Require().NoError(suite.cache.Save())
+	data, err := os.ReadFile(suite.path)
+	suite.NoError(err)
+	suite.Empty(data)
+}
+
+func (suite *PersistentTestSuite) TestMissingSnapshot() {
+	suite.Equal(0, suite.cache.Len())
+	suite.NoFileExists(suite.path)
+}
+
+func (suite *PersistentTestSuite) TestCorruptSnapshot() {
+	suite.Require().NoError(os.WriteFile(suite.path, []byte(`{"key":"example.com","value":true}`+"\nnot json\n"), 0o600))
+	_, err := NewPersistent(suite.path, time.Hour, zerolog.Nop())
+	suite.ErrorContains(err, "cache.json:2")
+}
+
+func (suite *PersistentTestSuite) TestSaveError() {
+	p, err := NewPersistent(filepath.Join(suite.path, "missing", "cache.json"), time.Hour, zerolog.Nop())
+	suite.Require().NoError(err)
+	suite.Error(p.Save())
+}
+
+func (suite *PersistentTestSuite) TestStartStop() {
+	p, err := NewPersistent(suite.path, 10*time.Millisecond, zerolog.Nop())
+	suite.Require().NoError(err)
+	p.SetEx("example.com", true, 60)
+	started := make(chan error)
+	go func() {
+		started <- p.Start()
+	}()
+	// The snapshot loop saves without waiting for Stop
+	suite.Eventually(func() bool {
+		_, err := os.Stat(suite.path)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	p.SetEx("www.example.com", true, 60)
+	suite.NoError(p.Stop(context.Background()))
+	suite.NoError(<-started)
+	suite.NoError(p.Stop(context.Background())) // Stopping twice only saves again
+
+	restarted, err := NewPersistent(suite.path, time.Hour, zerolog.Nop())
+	suite.Require().NoError(err)
+	suite.Equal(2, restarted.Len())
+}
+
+func (suite *PersistentTestSuite) TestSnapshotLeavesOutQueued() {
+	p := suite.open()
+	queue := models.NewDomainQueue(p, 60)
+	queue.Add("submitted.example.com")
+	suite.Equal([]string{"submitted.example.com"}, queue.Get())
+	queue.Add("queued.example.com")
+	suite.NoError(p.Stop(context.Background()))
+
+	// Only the submitted domain is skipped after a restart
+	restarted := suite.open()
+	queue = models.NewDomainQueue(restarted, 60)
+	queue.Add("submitted.example.com")
+	queue.Add("queued.example.com")
+	suite.Equal([]string{"queued.example.com"}, queue.Get())
+}
+
+func TestPersistentTestSuite(t *testing.T) {
+	suite.Run(t, new(PersistentTestSuite))
+}
@@ -0,0 +1,23 @@
+package models
+
+// NameFilter decides whether a normalized name, seen from client, may be queued. Check returns
+// the reason to reject it, or "" to accept it. The client is an address, with or without a port,
+// or "" when the source doesn't know it.
+type NameFilter interface {
+	Check(domain, client string) string
+}
+
+// WithNameFilter applies filter to every name in the filter stage, after normalization and before
+// the public suffix handling.
+func WithNameFilter(filter NameFilter) QueueOption {
+	return func(q *DomainQueue) {
+		q.filter = filter
+	}
+}
+
+// filterName returns the filter stage.
+func filterName(filter NameFilter) Processor {
+	return ProcessorFunc(func(name *Name) string {
+		return filter.Check(name.Domain, name.Client)
+	})
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// suffixFilter rejects names under a suffix, and everything from a client.
+type suffixFilter struct {
+	suffix string
+	client string
+}
+
+func (f suffixFilter) Check(domain, client string) string {
+	switch {
+	case strings.HasSuffix(domain, f.suffix):
+		return "denied"
+	case client != "" && client == f.client:
+		return "client-denied"
+	}
+	return ""
+}
+
+type FilterTestSuite struct {
+	suite.Suite
+	queue *DomainQueue
+}
+
+func (suite *FilterTestSuite) SetupTest() {
+	filter := suffixFilter{suffix: ".corp.example.internal", client: "192.0.2.66"}
+	suite.queue = NewDomainQueue(NewMockCache(), 3600, WithNameFilter(filter), WithRegisteredDomains())
+}
+
+func (suite *FilterTestSuite) TestAddFrom() {
+	suite.queue.AddFrom("www.example.com", "192.0.2.1")
+	suite.queue.AddFrom("example.org", "192.0.2.66")
+	suite.queue.Add("example.net")
+	suite.ElementsMatch([]string{"example.com", "example.net"}, suite.queue.Get())
+	suite.Equal(map[string]uint64{"client-denied": 1}, suite.queue.Stats().Rejected)
+}
+
+func (suite *FilterTestSuite) TestFilterSeesNormalizedFullName() {
+	// The filter runs on the normalized name, before it's collapsed to the registered domain
+	suite.queue.Add("DC1.Corp.Example.Internal")
+	suite.queue.Add("www.example.internal")
+	suite.Empty(suite.queue.Get())
+	suite.Equal(map[string]uint64{"denied": 1, RejectUnknownSuffix: 1}, suite.queue.Stats().Rejected)
+}
+
+func TestFilterTestSuite(t *testing.T) {
+	suite.Run(t, new(FilterTestSuite))
+}
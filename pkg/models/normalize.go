@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+// Reasons for rejecting a domain, counted in QueueStats.Rejected.
+const (
+	RejectInvalid            = "invalid"
+	RejectIDNADisallowedRune = "idna-disallowed-rune"
+	RejectIDNAInvalidLabel   = "idna-invalid-label"
+)
+
+// WithUnicodeForm also queues the U-label form of every IDN, next to the canonical A-label form.
+func WithUnicodeForm() QueueOption {
+	return func(q *DomainQueue) {
+		q.unicodeForm = true
+	}
+}
+
+// rejections counts rejected domains by reason.
+type rejections struct {
+	counters sync.Map // reason -> *atomic.Uint64
+}
+
+func (r *rejections) add(reason string) {
+	counter, ok := r.counters.Load(reason)
+	if !ok {
+		counter, _ = r.counters.LoadOrStore(reason, new(atomic.Uint64))
+	}
+	counter.(*atomic.Uint64).Add(1)
+}
+
+// snapshot returns the counters, or nil if nothing was rejected.
+func (r *rejections) snapshot() map[string]uint64 {
+	var counts map[string]uint64
+	r.counters.Range(func(reason, counter any) bool {
+		if counts == nil {
+			counts = make(map[string]uint64)
+		}
+		counts[reason.(string)] = counter.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
+
+// normalize returns the canonical A-label form of domain, or the reason it was rejected.
+func normalize(domain string) (string, string) {
+	ascii, err := utils.ToASCII(domain)
+	switch {
+	case errors.Is(err, utils.ErrIDNADisallowedRune):
+		return "", RejectIDNADisallowedRune
+	case err != nil:
+		return "", RejectIDNAInvalidLabel
+	case !utils.IsValidDomain(ascii):
+		return "", RejectInvalid
+	}
+	return ascii, ""
+}
+
+// normalizeName is the normalize stage.
+func normalizeName(name *Name) string {
+	ascii, reason := normalize(name.Domain)
+	name.Domain = ascii
+	name.normalized = true
+	return reason
+}
+
+// unicodeName is the unicode stage, it adds the U-label form of IDNs.
+func unicodeName(name *Name) string {
+	if utils.IsIDN(name.Domain) {
+		if unicode, err := utils.ToUnicode(name.Domain); err == nil && unicode != name.Domain {
+			name.Forms = append(name.Forms, unicode)
+		}
+	}
+	return ""
+}
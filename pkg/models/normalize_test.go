@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type NormalizeTestSuite struct {
+	suite.Suite
+	cache *MockCache
+}
+
+func (suite *NormalizeTestSuite) SetupTest() {
+	suite.cache = NewMockCache()
+}
+
+func (suite *NormalizeTestSuite) TestIDNFormsDedupe() {
+	queue := NewDomainQueue(suite.cache, 3600)
+	queue.Add("пример.com")
+	queue.Add("xn--e1afmkfd.com")
+	queue.Add("ПРИМЕР.COM")
+	queue.Add("XN--E1AFMKFD.com")
+	suite.Equal([]string{"xn--e1afmkfd.com"}, queue.Get())
+	suite.Nil(queue.Stats().Rejected)
+}
+
+func (suite *NormalizeTestSuite) TestUnicodeForm() {
+	queue := NewDomainQueue(suite.cache, 3600, WithUnicodeForm())
+	queue.Add("www.пример.com")
+	queue.Add("example.com")
+	suite.ElementsMatch([]string{"www.xn--e1afmkfd.com", "www.пример.com", "example.com"}, queue.Get())
+
+	// Both forms are cached
+	queue.Add("www.xn--e1afmkfd.com")
+	suite.Empty(queue.Get())
+}
+
+func (suite *NormalizeTestSuite) TestRejected() {
+	queue := NewDomainQueue(suite.cache, 3600)
+	queue.Add("foo bar.example.com")
+	queue.Add("192.168.1.1")
+	queue.Add("xn--zz.com")
+	queue.Add("exam\u0085ple.com")
+	queue.Add("example.com")
+	suite.Equal([]string{"example.com"}, queue.Get())
+	suite.Equal(map[string]uint64{
+		RejectInvalid:            2,
+		RejectIDNAInvalidLabel:   1,
+		RejectIDNADisallowedRune: 1,
+	}, queue.Stats().Rejected)
+}
+
+func TestNormalizeTestSuite(t *testing.T) {
+	suite.Run(t, new(NormalizeTestSuite))
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// OverflowPolicy decides what happens to a new domain when the queue is at its maximum size.
+type OverflowPolicy string
+
+const (
+	// DropNewest rejects the new domain.
+	DropNewest OverflowPolicy = "drop-newest"
+	// DropOldest evicts the oldest queued domain to make room for the new one.
+	DropOldest OverflowPolicy = "drop-oldest"
+	// SpillToDisk appends the new domain to a spill file that is drained on later Get calls.
+	SpillToDisk OverflowPolicy = "spill-to-disk"
+	// BlockWithTimeout makes Add wait for room, then rejects the domain if none appeared in time.
+	BlockWithTimeout OverflowPolicy = "block-with-timeout"
+
+	DefaultBlockTimeout = time.Second
+)
+
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	switch OverflowPolicy(policy) {
+	case DropNewest, DropOldest, SpillToDisk, BlockWithTimeout:
+		return OverflowPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q, expected one of %s, %s, %s, %s",
+			policy, DropNewest, DropOldest, SpillToDisk, BlockWithTimeout)
+	}
+}
+
+// QueueOption configures a DomainQueue.
+type QueueOption func(*DomainQueue)
+
+// WithMaxSize bounds the number of domains held in memory, 0 leaves the queue unbounded.
+func WithMaxSize(size int) QueueOption {
+	return func(q *DomainQueue) {
+		q.maxSize = int64(size)
+	}
+}
+
+func WithOverflowPolicy(policy OverflowPolicy) QueueOption {
+	return func(q *DomainQueue) {
+		q.policy = policy
+	}
+}
+
+// WithSpillFile sets the file used by SpillToDisk. Domains left in it by a previous run are submitted too.
+func WithSpillFile(path string) QueueOption {
+	return func(q *DomainQueue) {
+		q.spill = &spillFile{path: path}
+	}
+}
+
+func WithBlockTimeout(timeout time.Duration) QueueOption {
+	return func(q *DomainQueue) {
+		q.blockTimeout = timeout
+	}
+}
+
+// QueueStats are the queue size and the cumulative overflow and rejection counters.
+type QueueStats struct {
+	Queued      int               // Domains held in memory
+	Spilled     int               // Domains waiting in the spill file
+	Dropped     uint64            // New domains rejected because the queue was full
+	Evicted     uint64            // Queued domains discarded by DropOldest
+	SpillErrors uint64            // Failed spill file reads and writes, failed writes are also counted as dropped
+	Rejected    map[string]uint64 // Invalid domains by reason, nil if there were none
+}
+
+// tryReserve takes a slot if the queue is below its maximum size.
+func (q *DomainQueue) tryReserve() bool {
+	for {
+		size := q.size.Load()
+		if size >= q.maxSize {
+			return false
+		}
+		if q.size.CompareAndSwap(size, size+1) {
+			return true
+		}
+	}
+}
+
+// reserve takes a slot for domain, applying the overflow policy when the queue is full.
+// It must be called without holding any shard lock.
+func (q *DomainQueue) reserve(index uint64, domain string) bool {
+	if q.maxSize <= 0 {
+		q.size.Add(1)
+		return true
+	}
+	if q.tryReserve() {
+		return true
+	}
+	switch q.policy {
+	case DropOldest:
+		if q.evictOldest(index) {
+			return true // The evicted domain's slot is reused
+		}
+	case SpillToDisk:
+		if q.spill != nil {
+			if err := q.spill.write(domain); err == nil {
+				q.cache.SetEx(domain, true, q.cacheTTL)
+				return false
+			}
+			q.spillErrors.Add(1)
+		}
+	case BlockWithTimeout:
+		if q.waitForSpace() {
+			return true
+		}
+	}
+	q.dropped.Add(1)
+	return false
+}
+
+// release gives back a slot that was reserved for a domain that turned out to be a duplicate.
+func (q *DomainQueue) release() {
+	q.size.Add(-1)
+	q.signalSpace()
+}
+
+// evictOldest drops the oldest domain of the shard at index, or of the next non-empty shard.
+// Shards are drained in insertion order, so this is the oldest domain of that shard, not of the queue.
+func (q *DomainQueue) evictOldest(index uint64) bool {
+	for i := uint64(0); i < QueueShards; i++ {
+		shard := q.shards[(index+i)&(QueueShards-1)]
+		shard.lock.Lock()
+		if len(shard.order) > 0 {
+			oldest := shard.order[0]
+			shard.order = shard.order[1:]
+			delete(shard.domains, oldest)
+			shard.lock.Unlock()
+			q.evicted.Add(1)
+			return true
+		}
+		shard.lock.Unlock()
+	}
+	return false
+}
+
+func (q *DomainQueue) waitForSpace() bool {
+	deadline := time.NewTimer(q.blockTimeout)
+	defer deadline.Stop()
+	for {
+		// Take the channel before retrying so a Get in between is not missed
+		q.spaceLock.Lock()
+		space := q.space
+		q.spaceLock.Unlock()
+		if q.tryReserve() {
+			return true
+		}
+		select {
+		case <-space:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+// signalSpace wakes up every Add blocked in waitForSpace.
+func (q *DomainQueue) signalSpace() {
+	if q.policy != BlockWithTimeout {
+		return
+	}
+	q.spaceLock.Lock()
+	close(q.space)
+	q.space = make(chan struct{})
+	q.spaceLock.Unlock()
+}
+
+func (q *DomainQueue) Stats() QueueStats {
+	stats := QueueStats{
+		Queued:      q.Count(),
+		Dropped:     q.dropped.Load(),
+		Evicted:     q.evicted.Load(),
+		SpillErrors: q.spillErrors.Load(),
+		Rejected:    q.rejected.snapshot(),
+	}
+	if q.spill != nil {
+		stats.Spilled = q.spill.pending()
+	}
+	return stats
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OverflowTestSuite struct {
+	suite.Suite
+	cache *MockCache
+}
+
+func (suite *OverflowTestSuite) SetupTest() {
+	suite.cache = NewMockCache()
+}
+
+func (suite *OverflowTestSuite) TestParseOverflowPolicy() {
+	for _, policy := range []OverflowPolicy{DropNewest, DropOldest, SpillToDisk, BlockWithTimeout} {
+		parsed, err := ParseOverflowPolicy(string(policy))
+		suite.NoError(err)
+		suite.Equal(policy, parsed)
+	}
+	_, err := ParseOverflowPolicy("drop-everything")
+	suite.Error(err)
+}
+
+func (suite *OverflowTestSuite) TestUnbounded() {
+	queue := NewDomainQueue(suite.cache, 3600)
+	for _, domain := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		queue.Add(domain)
+	}
+	suite.Equal(3, queue.Count())
+	suite.Equal(QueueStats{Queued: 3}, queue.Stats())
+}
+
+func (suite *OverflowTestSuite) TestDropNewest() {
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(2))
+	queue.Add("a.example.com")
+	queue.Add("b.example.com")
+	queue.Add("c.example.com")
+	queue.Add("a.example.com") // Duplicates are not counted as drops
+	suite.Equal(QueueStats{Queued: 2, Dropped: 1}, queue.Stats())
+	suite.ElementsMatch([]string{"a.example.com", "b.example.com"}, queue.Get())
+
+	// Get frees the slots
+	queue.Add("d.example.com")
+	suite.Equal([]string{"d.example.com"}, queue.Get())
+	// Dropped domains are not cached, so they are picked up again
+	queue.Add("c.example.com")
+	suite.Equal([]string{"c.example.com"}, queue.Get())
+}
+
+func (suite *OverflowTestSuite) TestDropOldest() {
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(2), WithOverflowPolicy(DropOldest))
+	queue.Add("a.example.com")
+	queue.Add("b.example.com")
+	queue.Add("c.example.com")
+	suite.Equal(QueueStats{Queued: 2, Evicted: 1}, queue.Stats())
+	domains := queue.Get()
+	suite.Len(domains, 2)
+	suite.Contains(domains, "c.example.com")
+}
+
+func (suite *OverflowTestSuite) TestDropOldestSameShard() {
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(3), WithOverflowPolicy(DropOldest))
+	// The queue evicts from the new domain's shard first, find four domains sharing one
+	domains := []string{"host0.example.com"}
+	shard := queue.shardIndex(domains[0])
+	for i := 1; len(domains) < 4; i++ {
+		if domain := fmt.Sprintf("host%d.example.com", i); queue.shardIndex(domain) == shard {
+			domains = append(domains, domain)
+		}
+	}
+	for _, domain := range domains {
+		queue.Add(domain)
+	}
+	suite.Equal(domains[1:], queue.Get())
+}
+
+func (suite *OverflowTestSuite) TestDropOldestNotCached() {
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(1), WithOverflowPolicy(DropOldest))
+	queue.Add("a.example.com")
+	queue.Add("b.example.com")
+	suite.Equal(QueueStats{Queued: 1, Evicted: 1}, queue.Stats())
+	// The evicted domain was never submitted, so it is queued again when it's seen again
+	queue.Add("a.example.com")
+	suite.Equal([]string{"a.example.com"}, queue.Get())
+	queue.Add("a.example.com")
+	suite.Empty(queue.Get())
+}
+
+func (suite *OverflowTestSuite) TestSpillToDisk() {
+	path := filepath.Join(suite.T().TempDir(), "queue.spill")
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(2), WithOverflowPolicy(SpillToDisk), WithSpillFile(path))
+	for _, domain := range []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com"} {
+		queue.Add(domain)
+	}
+	queue.Add("c.example.com") // Spilled domains are cached and not spilled twice
+	suite.Equal(QueueStats{Queued: 2, Spilled: 3}, queue.Stats())
+
+	// Each Get returns the queue plus at most the queue size of spilled domains, oldest first
+	domains := queue.Get()
+	suite.ElementsMatch([]string{"a.example.com", "b.example.com"}, domains[:2])
+	suite.Equal([]string{"c.example.com", "d.example.com"}, domains[2:])
+	suite.Equal([]string{"e.example.com"}, queue.Get())
+	suite.Empty(queue.Get())
+	suite.Equal(QueueStats{}, queue.Stats())
+}
+
+func (suite *OverflowTestSuite) TestSpillSurvivesRestart() {
+	path := filepath.Join(suite.T().TempDir(), "queue.spill")
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(1), WithOverflowPolicy(SpillToDisk), WithSpillFile(path))
+	queue.Add("a.example.com")
+	queue.Add("b.example.com")
+	queue.Add("c.example.com")
+
+	restarted := NewDomainQueue(NewMockCache(), 3600, WithMaxSize(1), WithOverflowPolicy(SpillToDisk), WithSpillFile(path))
+	suite.Equal([]string{"b.example.com"}, restarted.Get())
+	suite.Equal(1, restarted.Stats().Spilled)
+	suite.Equal([]string{"c.example.com"}, restarted.Get())
+}
+
+func (suite *OverflowTestSuite) TestSpillError() {
+	path := filepath.Join(suite.T().TempDir(), "missing", "queue.spill")
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(1), WithOverflowPolicy(SpillToDisk), WithSpillFile(path))
+	queue.Add("a.example.com")
+	queue.Add("b.example.com")
+	suite.Equal(QueueStats{Queued: 1, Dropped: 1, SpillErrors: 1}, queue.Stats())
+}
+
+func (suite *OverflowTestSuite) TestBlockWithTimeoutDrops() {
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(1), WithOverflowPolicy(BlockWithTimeout),
+		WithBlockTimeout(20*time.Millisecond))
+	queue.Add("a.example.com")
+	start := time.Now()
+	queue.Add("b.example.com")
+	suite.GreaterOrEqual(time.Since(start), 20*time.Millisecond)
+	suite.Equal(QueueStats{Queued: 1, Dropped: 1}, queue.Stats())
+}
+
+func (suite *OverflowTestSuite) TestBlockWithTimeoutWaitsForGet() {
+	queue := NewDomainQueue(suite.cache, 3600, WithMaxSize(1), WithOverflowPolicy(BlockWithTimeout),
+		WithBlockTimeout(5*time.Second))
+	queue.Add("a.example.com")
+	added := make(chan struct{})
+	go func() {
+		queue.Add("b.example.com")
+		close(added)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	suite.Equal([]string{"a.example.com"}, queue.Get())
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		suite.Fail("Add did not resume after Get")
+	}
+	suite.Equal([]string{"b.example.com"}, queue.Get())
+	suite.Equal(uint64(0), queue.Stats().Dropped)
+}
+
+func TestOverflowTestSuite(t *testing.T) {
+	suite.Run(t, new(OverflowTestSuite))
+}
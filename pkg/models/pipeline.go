@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Stages of the built-in pipeline. Names reported by sources go through the stages in order,
+// then the queue deduplicates them and routes them by its overflow policy, see overflow.go.
+const (
+	StageTransform = "transform" // WithTransformer, rewrites names, e.g. to remove identifiers
+	StageNormalize = "normalize" // Always configured, converts IDNs to A-labels and validates names
+	StageFilter    = "filter"    // WithNameFilter, deny and allow rules
+	StageSuffix    = "suffix"    // WithPublicSuffixList and WithRegisteredDomains
+	StageUnicode   = "unicode"   // WithUnicodeForm, adds the U-label form of IDNs
+)
+
+// DefaultPipeline is the order stages run in unless WithPipeline sets another one.
+var DefaultPipeline = []string{StageTransform, StageNormalize, StageFilter, StageSuffix, StageUnicode}
+
+// Name is a domain on its way through the pipeline. Enrichers add what they derive to Forms: the
+// queue and the submission API carry bare names, so there is nothing else to attach data to.
+type Name struct {
+	Domain     string   // Rewritten by the processors, queued if none of them rejects it
+	Client     string   // Address of the client that looked the name up, "" if the source doesn't know it
+	Forms      []string // Other forms queued next to Domain, like the U-label
+	normalized bool     // Set by the normalize stage, so later rewrites are validated again
+}
+
+// Processor is one stage of the pipeline. Process may rewrite name and returns the reason to reject
+// it, or "" to pass it on. Processors are shared by all sources and must be safe for concurrent use.
+// Processors running after normalize must leave Domain a valid A-label name.
+//
+// Deduplication and routing aren't stages, the queue runs them in add once every stage is done. They
+// have to see the final name, and checking for duplicates has to be atomic with taking a queue slot
+// under the shard lock. Routing is the overflow policy: queue, evict, spill to disk or drop.
+type Processor interface {
+	Process(name *Name) string
+}
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc func(name *Name) string
+
+func (f ProcessorFunc) Process(name *Name) string {
+	return f(name)
+}
+
+// stage is a processor added with WithProcessor.
+type stage struct {
+	name      string
+	processor Processor
+}
+
+// WithProcessor adds processor as a stage, e.g. an enricher, or replaces the built-in stage of that
+// name. Added stages run before unicode unless WithPipeline places them.
+func WithProcessor(name string, processor Processor) QueueOption {
+	return func(q *DomainQueue) {
+		q.stages = append(q.stages, stage{name: name, processor: processor})
+	}
+}
+
+// WithPipeline sets the order stages run in. Stages that aren't listed don't run, listed stages
+// that aren't configured are skipped. Without normalize, names reach the queue unvalidated.
+func WithPipeline(stages ...string) QueueOption {
+	return func(q *DomainQueue) {
+		q.order = stages
+	}
+}
+
+// ParsePipeline parses a comma separated list of built-in stages. Normalize is required and
+// has to run before the stages that expect A-labels, unicode has to run last.
+func ParsePipeline(list string) ([]string, error) {
+	var stages []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			continue
+		case name == "dedupe" || name == "route":
+			return nil, fmt.Errorf("pipeline stage %q always runs last, in the queue", name)
+		case !slices.Contains(DefaultPipeline, name):
+			return nil, fmt.Errorf("unknown pipeline stage %q, expected %s", name, strings.Join(DefaultPipeline, ", "))
+		case slices.Contains(stages, name):
+			return nil, fmt.Errorf("pipeline stage %q is listed twice", name)
+		}
+		stages = append(stages, name)
+	}
+	normalize := slices.Index(stages, StageNormalize)
+	if normalize < 0 {
+		return nil, fmt.Errorf("pipeline has no %s stage", StageNormalize)
+	}
+	for _, name := range []string{StageFilter, StageSuffix, StageUnicode} {
+		if index := slices.Index(stages, name); index >= 0 && index < normalize {
+			return nil, fmt.Errorf("pipeline stage %q has to run after %s", name, StageNormalize)
+		}
+	}
+	if unicode := slices.Index(stages, StageUnicode); unicode >= 0 && unicode != len(stages)-1 {
+		return nil, fmt.Errorf("pipeline stage %q has to run last", StageUnicode)
+	}
+	return stages, nil
+}
+
+// pipeline returns the configured processors in the order they run.
+func (q *DomainQueue) pipeline() []Processor {
+	stages := map[string]Processor{StageNormalize: ProcessorFunc(normalizeName)}
+	if q.transformer != nil {
+		stages[StageTransform] = transformName(q.transformer)
+	}
+	if q.filter != nil {
+		stages[StageFilter] = filterName(q.filter)
+	}
+	if q.suffixes != nil {
+		stages[StageSuffix] = ProcessorFunc(q.suffixName)
+	}
+	if q.unicodeForm {
+		stages[StageUnicode] = ProcessorFunc(unicodeName)
+	}
+	order := q.order
+	if order == nil {
+		order = slices.Clone(DefaultPipeline[:len(DefaultPipeline)-1])
+		for _, added := range q.stages {
+			if !slices.Contains(DefaultPipeline, added.name) && !slices.Contains(order, added.name) {
+				order = append(order, added.name)
+			}
+		}
+		order = append(order, StageUnicode)
+	}
+	for _, added := range q.stages {
+		stages[added.name] = added.processor
+	}
+	processors := make([]Processor, 0, len(order))
+	for _, name := range order {
+		if processor, ok := stages[name]; ok {
+			processors = append(processors, processor)
+		}
+	}
+	return processors
+}
+
+// process runs name through the pipeline and returns the reason it was rejected, or "".
+func (q *DomainQueue) process(name *Name) string {
+	for _, processor := range q.processors {
+		if reason := processor.Process(name); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
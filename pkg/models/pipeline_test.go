@@ -0,0 +1,131 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type PipelineTestSuite struct {
+	suite.Suite
+	cache *MockCache
+}
+
+func (suite *PipelineTestSuite) SetupTest() {
+	suite.cache = NewMockCache()
+}
+
+func (suite *PipelineTestSuite) TestAddedStage() {
+	var seen []string
+	// An enricher that also queues the parent of every www name, and sees the normalized name
+	enricher := ProcessorFunc(func(name *Name) string {
+		seen = append(seen, name.Domain)
+		if parent, ok := strings.CutPrefix(name.Domain, "www."); ok {
+			name.Forms = append(name.Forms, parent)
+		}
+		return ""
+	})
+	queue := NewDomainQueue(suite.cache, 3600, WithProcessor("parent", enricher), WithUnicodeForm())
+	queue.Add("WWW.Example.com")
+	queue.Add("www.пример.com")
+	queue.Add("bad..name")
+	suite.ElementsMatch([]string{
+		"www.example.com", "example.com",
+		"www.xn--e1afmkfd.com", "xn--e1afmkfd.com", "www.пример.com",
+	}, queue.Get())
+	suite.Equal([]string{"www.example.com", "www.xn--e1afmkfd.com"}, seen)
+}
+
+func (suite *PipelineTestSuite) TestAddedStageRejects() {
+	queue := NewDomainQueue(suite.cache, 3600, WithProcessor("no-ads", ProcessorFunc(func(name *Name) string {
+		if strings.HasPrefix(name.Domain, "ads.") {
+			return "ads"
+		}
+		return ""
+	})))
+	queue.Add("ads.example.com")
+	queue.Add("www.example.com")
+	suite.Equal([]string{"www.example.com"}, queue.Get())
+	suite.Equal(map[string]uint64{"ads": 1}, queue.Stats().Rejected)
+}
+
+func (suite *PipelineTestSuite) TestReplaceBuiltInStage() {
+	queue := NewDomainQueue(suite.cache, 3600, WithProcessor(StageNormalize, ProcessorFunc(func(name *Name) string {
+		name.Domain = strings.ToLower(name.Domain)
+		return ""
+	})))
+	queue.Add("Not A Domain")
+	suite.Equal([]string{"not a domain"}, queue.Get())
+}
+
+func (suite *PipelineTestSuite) TestOrder() {
+	filter := suffixFilter{suffix: "shop.example.co.uk"}
+	// By default the filter sees the full name
+	queue := NewDomainQueue(suite.cache, 3600, WithNameFilter(filter), WithRegisteredDomains())
+	queue.Add("www.shop.example.co.uk")
+	suite.Empty(queue.Get())
+
+	// After the suffix stage it sees the registered domain
+	queue = NewDomainQueue(NewMockCache(), 3600, WithNameFilter(filter), WithRegisteredDomains(),
+		WithPipeline(StageNormalize, StageSuffix, StageFilter))
+	queue.Add("www.shop.example.co.uk")
+	suite.Equal([]string{"example.co.uk"}, queue.Get())
+}
+
+func (suite *PipelineTestSuite) TestTransformAfterNormalize() {
+	queue := NewDomainQueue(suite.cache, 3600, WithTransformer(prefixTransformer("user42")),
+		WithNameFilter(suffixFilter{suffix: "user42.example.com"}),
+		WithPipeline(StageNormalize, StageFilter, StageTransform))
+	// The filter sees the name before it's rewritten, and rewritten names are validated again
+	queue.Add("User42.Example.com")
+	queue.Add("user42.www.example.org")
+	queue.Add("user42.-bad-.example.net")
+	suite.Equal([]string{"www.example.org"}, queue.Get())
+	suite.Equal(map[string]uint64{"denied": 1, RejectInvalid: 1}, queue.Stats().Rejected)
+}
+
+func (suite *PipelineTestSuite) TestStagesLeftOut() {
+	queue := NewDomainQueue(suite.cache, 3600, WithRegisteredDomains(), WithPipeline(StageNormalize))
+	queue.Add("www.example.co.uk")
+	suite.Equal([]string{"www.example.co.uk"}, queue.Get())
+}
+
+func (suite *PipelineTestSuite) TestAddObservation() {
+	queue := NewDomainQueue(suite.cache, 3600, WithNameFilter(suffixFilter{suffix: ".invalid", client: "192.0.2.66"}))
+	queue.AddObservation(types.Observation{
+		Query:   "www.example.com.",
+		Client:  "192.0.2.1",
+		Answers: []string{"cdn.example.net.", "192.0.2.10", "2001:db8::1"},
+	})
+	queue.AddObservation(types.Observation{Query: "example.org", Client: "192.0.2.66"})
+	suite.ElementsMatch([]string{"www.example.com", "cdn.example.net"}, queue.Get())
+	suite.Equal(map[string]uint64{"client-denied": 1}, queue.Stats().Rejected)
+}
+
+func (suite *PipelineTestSuite) TestParsePipeline() {
+	stages, err := ParsePipeline(strings.Join(DefaultPipeline, ","))
+	suite.NoError(err)
+	suite.Equal(DefaultPipeline, stages)
+	stages, err = ParsePipeline(" normalize, suffix ,filter,transform ")
+	suite.NoError(err)
+	suite.Equal([]string{StageNormalize, StageSuffix, StageFilter, StageTransform}, stages)
+
+	for list, message := range map[string]string{
+		"normalize,enrich":         "unknown",
+		"normalize,dedupe":         "in the queue",
+		"normalize,filter,filter":  "twice",
+		"transform,filter":         "no normalize",
+		"filter,normalize":         "after normalize",
+		"normalize,unicode,suffix": "last",
+		"":                         "no normalize",
+	} {
+		_, err := ParsePipeline(list)
+		suite.ErrorContains(err, message, list)
+	}
+}
+
+func TestPipelineTestSuite(t *testing.T) {
+	suite.Run(t, new(PipelineTestSuite))
+}
@@ -1,10 +1,18 @@
 package models
 
 import (
-	"strings"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+	"github.com/weppos/publicsuffix-go/publicsuffix"
+)
+
+const (
+	// QueueShards is the number of independently locked sets a queue is split into, a power of two.
+	QueueShards = 64
 )
 
 type CacheInterface interface {
@@ -12,54 +20,180 @@ type CacheInterface interface {
 	SetEx(key string, value interface{}, expires int64)
 }
 
+// queueShard is one lock stripe of the queue. A domain always hashes to the same shard,
+// so deduplicating against the shard under its lock is exact.
+type queueShard struct {
+	lock    sync.Mutex
+	domains map[string]struct{}
+	order   []string // Domains in insertion order
+}
+
+func (s *queueShard) reset() {
+	s.domains = make(map[string]struct{})
+	s.order = nil
+}
+
+// DomainQueue holds the domains waiting to be submitted, deduplicated against each other and the cache.
+// It's sharded, so the domains are only reachable through Get and Count.
 type DomainQueue struct {
-	Domains  []string
-	Lock     *sync.Mutex
+	shards   []*queueShard
+	seed     maphash.Seed
 	cache    CacheInterface
 	cacheTTL int64 // Cache TTL in seconds
+	// Overflow handling, see overflow.go
+	maxSize      int64
+	policy       OverflowPolicy
+	blockTimeout time.Duration
+	spill        *spillFile
+	size         atomic.Int64 // Queued plus reserved domains
+	space        chan struct{}
+	spaceLock    sync.Mutex
+	dropped      atomic.Uint64
+	evicted      atomic.Uint64
+	spillErrors  atomic.Uint64
+	// Normalization, see normalize.go
+	unicodeForm bool
+	rejected    rejections
+	// Operator rules, see filter.go and transform.go
+	filter      NameFilter
+	transformer Transformer
+	// Public suffix handling, see suffix.go
+	suffixes       *publicsuffix.List
+	registeredOnly bool
+	// Processing pipeline, see pipeline.go
+	order      []string
+	stages     []stage
+	processors []Processor
+}
+
+func (q *DomainQueue) shardIndex(domain string) uint64 {
+	return maphash.String(q.seed, domain) & (QueueShards - 1)
 }
 
+// queued reports whether domain is in shard, the caller holds the shard lock.
+func (s *queueShard) queued(domain string) bool {
+	_, ok := s.domains[domain]
+	return ok
+}
+
+// Add runs domain through the pipeline, see pipeline.go, and queues the result. With the default
+// stages that's the canonical A-label form of domain, after the transformer if there is one, and its
+// U-label form with WithUnicodeForm. Names rejected by a stage are counted by reason and dropped.
 func (q *DomainQueue) Add(domain string) {
-	q.Lock.Lock()
-	defer q.Lock.Unlock()
-	// Fix mangled domain names
-	domain = strings.ToLower(domain)
+	q.AddFrom(domain, "")
+}
+
+// AddFrom is Add for sources that know the client that looked domain up, so client rules apply.
+func (q *DomainQueue) AddFrom(domain, client string) {
+	name := Name{Domain: domain, Client: client}
+	if reason := q.process(&name); reason != "" {
+		q.rejected.add(reason)
+		return
+	}
+	q.add(name.Domain)
+	for _, form := range name.Forms {
+		q.add(form)
+	}
+}
+
+// AddObservation adds the query name and the host name answers of observation, from its client.
+func (q *DomainQueue) AddObservation(observation types.Observation) {
+	for _, name := range observation.Names() {
+		q.AddFrom(name, observation.Client)
+	}
+}
+
+func (q *DomainQueue) add(domain string) {
+	// The cache has its own locking and may be slow, so it's checked without holding the shard lock
 	if _, ok := q.cache.Get(domain); ok {
 		return // Domain already exists in the cache
 	}
-	// Validate the domain before adding it to the queue
-	if !utils.IsValidDomain(domain) {
+	index := q.shardIndex(domain)
+	shard := q.shards[index]
+	if q.maxSize > 0 {
+		// Don't let duplicates take a slot, or trigger the overflow policy, when the queue is full
+		shard.lock.Lock()
+		queued := shard.queued(domain)
+		shard.lock.Unlock()
+		if queued {
+			return
+		}
+	}
+	if !q.reserve(index, domain) {
 		return
 	}
-	for _, d := range q.Domains {
-		if d == domain {
-			return // Domain already exists in the queue
-		}
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if shard.queued(domain) {
+		q.release() // Domain already exists in the queue
+		return
 	}
-	q.Domains = append(q.Domains, domain)
-	q.cache.SetEx(domain, true, q.cacheTTL) // Store in cache with TTL
+	shard.domains[domain] = struct{}{}
+	shard.order = append(shard.order, domain)
 }
 
+// Get returns the queued domains and empties the queue. With SpillToDisk it also returns
+// up to the maximum queue size of spilled domains.
+//
+// Domains are cached once Get hands them out for submission, not when they are queued, so ones that
+// are evicted or lost on shutdown are picked up again the next time they are seen. That happens after
+// the shard lock is released, so a domain added again right then may be queued a second time.
 func (q *DomainQueue) Get() []string {
-	q.Lock.Lock()
-	defer q.Lock.Unlock()
-	domains := make([]string, len(q.Domains))
-	copy(domains, q.Domains)
-	q.Domains = nil // Clear the queue after getting the domains
+	domains := make([]string, 0, q.Count())
+	for _, shard := range q.shards {
+		shard.lock.Lock()
+		drained := shard.order
+		q.size.Add(-int64(len(drained)))
+		shard.reset()
+		shard.lock.Unlock()
+		for _, domain := range drained {
+			q.cache.SetEx(domain, true, q.cacheTTL) // Store in cache with TTL
+		}
+		domains = append(domains, drained...)
+	}
+	q.signalSpace()
+	if q.spill != nil {
+		spilled, err := q.spill.read(int(q.maxSize))
+		if err != nil {
+			q.spillErrors.Add(1)
+		}
+		domains = append(domains, spilled...)
+	}
 	return domains
 }
 
+// Count returns the number of domains held in memory.
 func (q *DomainQueue) Count() int {
-	q.Lock.Lock()
-	defer q.Lock.Unlock()
-	return len(q.Domains)
+	count := 0
+	for _, shard := range q.shards {
+		shard.lock.Lock()
+		count += len(shard.order)
+		shard.lock.Unlock()
+	}
+	return count
 }
 
-func NewDomainQueue(cache CacheInterface, cacheTTL int64) *DomainQueue {
-	return &DomainQueue{
-		Domains:  make([]string, 0),
-		Lock:     &sync.Mutex{},
-		cache:    cache,
-		cacheTTL: cacheTTL,
+func NewDomainQueue(cache CacheInterface, cacheTTL int64, options ...QueueOption) *DomainQueue {
+	shards := make([]*queueShard, QueueShards)
+	for i := range shards {
+		shards[i] = &queueShard{}
+		shards[i].reset()
+	}
+	queue := &DomainQueue{
+		shards:       shards,
+		seed:         maphash.MakeSeed(),
+		cache:        cache,
+		cacheTTL:     cacheTTL,
+		policy:       DropNewest,
+		blockTimeout: DefaultBlockTimeout,
+		space:        make(chan struct{}),
+	}
+	for _, option := range options {
+		option(queue)
+	}
+	if queue.registeredOnly && queue.suffixes == nil {
+		queue.suffixes = publicsuffix.DefaultList
 	}
+	queue.processors = queue.pipeline()
+	return queue
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// benchmarkDomains returns n distinct, valid domains so that name generation isn't part of the timing.
+func benchmarkDomains(n int) []string {
+	domains := make([]string, n)
+	for i := range domains {
+		domains[i] = "host" + strconv.Itoa(i) + ".example" + strconv.Itoa(i%97) + ".com"
+	}
+	return domains
+}
+
+func reportAddRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "adds/s")
+}
+
+// BenchmarkAddUnique adds a new domain every time, the worst case for the queue.
+func BenchmarkAddUnique(b *testing.B) {
+	domains := benchmarkDomains(b.N)
+	queue := NewDomainQueue(NewMockCache(), 3600)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		queue.Add(domains[i])
+	}
+	reportAddRate(b)
+}
+
+// BenchmarkAddDuplicate adds the same 10k domains over and over, as a busy resolver does.
+func BenchmarkAddDuplicate(b *testing.B) {
+	domains := benchmarkDomains(10000)
+	queue := NewDomainQueue(NewMockCache(), 3600)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		queue.Add(domains[i%len(domains)])
+	}
+	reportAddRate(b)
+}
+
+// BenchmarkAddParallel adds unique domains from all CPUs, which only contend on the same shard.
+func BenchmarkAddParallel(b *testing.B) {
+	domains := benchmarkDomains(b.N)
+	queue := NewDomainQueue(NewMockCache(), 3600)
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			queue.Add(domains[next.Add(1)-1])
+		}
+	})
+	reportAddRate(b)
+}
+
+// BenchmarkAddWhileDraining adds while the queue is periodically drained, like the submitter does.
+func BenchmarkAddWhileDraining(b *testing.B) {
+	domains := benchmarkDomains(b.N)
+	queue := NewDomainQueue(NewMockCache(), 3600)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		queue.Add(domains[i])
+		if i%10000 == 0 {
+			queue.Get()
+		}
+	}
+	reportAddRate(b)
+}
@@ -193,11 +193,26 @@ func (suite *QueueTestSuite) TestNewDomainQueue() {
 	queue := NewDomainQueue(cache, ttl)
 	
 	suite.NotNil(queue)
-	suite.NotNil(queue.Lock)
-	suite.NotNil(queue.Domains)
+	suite.Len(queue.shards, QueueShards)
 	suite.Equal(cache, queue.cache)
 	suite.Equal(ttl, queue.cacheTTL)
-	suite.Equal(0, len(queue.Domains))
+	suite.Equal(0, queue.Count())
+}
+
+func (suite *QueueTestSuite) TestGetDrainsAllShards() {
+	for i := 0; i < 1000; i++ {
+		suite.queue.Add(fmt.Sprintf("host%d.example.com", i))
+	}
+	suite.Equal(1000, suite.queue.Count())
+	domains := suite.queue.Get()
+	suite.Len(domains, 1000)
+	unique := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		unique[domain] = struct{}{}
+	}
+	suite.Len(unique, 1000)
+	suite.Equal(0, suite.queue.Count())
+	suite.Empty(suite.queue.Get())
 }
 
 func TestQueueTestSuite(t *testing.T) {
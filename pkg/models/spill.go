@@ -0,0 +1,152 @@
+package models
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// spillFile is an append-only file of one domain per line, read back from the front. How far it
+// has been read is kept in a file next to it, so a restart doesn't return the same lines again.
+type spillFile struct {
+	lock   sync.Mutex
+	path   string
+	file   *os.File
+	offset int64 // Start of the oldest unread line
+	count  int   // Unread lines
+}
+
+// open opens the spill file on first use, picking up whatever a previous run left unread in it.
+func (s *spillFile) open() error {
+	if s.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.offset = s.loadOffset(file)
+	reader := bufio.NewReader(io.NewSectionReader(file, s.offset, 1<<62))
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.HasSuffix(line, "\n") {
+			s.count++
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				_ = file.Close()
+				return err
+			}
+			break
+		}
+	}
+	s.file = file
+	return nil
+}
+
+func (s *spillFile) offsetPath() string {
+	return s.path + ".offset"
+}
+
+// loadOffset returns the saved read offset, or 0 if there is none or it doesn't fit the file,
+// e.g. because the file was truncated after the offset was saved.
+func (s *spillFile) loadOffset(file *os.File) int64 {
+	data, err := os.ReadFile(s.offsetPath())
+	if err != nil {
+		return 0
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || offset <= 0 {
+		return 0
+	}
+	info, err := file.Stat()
+	if err != nil || offset > info.Size() {
+		return 0
+	}
+	// The offset is always the start of a line
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, offset-1); err != nil || last[0] != '\n' {
+		return 0
+	}
+	return offset
+}
+
+// saveOffset records the read offset, replacing the file so a crash never leaves half of it.
+func (s *spillFile) saveOffset() error {
+	if s.offset == 0 {
+		if err := os.Remove(s.offsetPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tmp := s.offsetPath() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(s.offset, 10)+"\n"), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.offsetPath())
+}
+
+func (s *spillFile) write(domain string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.open(); err != nil {
+		return err
+	}
+	if _, err := s.file.WriteString(domain + "\n"); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// read returns up to limit of the oldest domains and removes them from the file.
+func (s *spillFile) read(limit int) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if limit <= 0 {
+		return nil, nil
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	start := s.offset
+	domains := make([]string, 0, min(limit, s.count))
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.offset, 1<<62))
+	for len(domains) < limit {
+		line, err := reader.ReadString('\n')
+		if !strings.HasSuffix(line, "\n") {
+			// A partial line is left for the next read, it may still be being written
+			if err != nil && !errors.Is(err, io.EOF) {
+				return domains, err
+			}
+			break
+		}
+		s.offset += int64(len(line))
+		s.count--
+		if domain := strings.TrimSpace(line); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if s.count <= 0 {
+		// Everything was read, start over so the file does not grow forever
+		s.count = 0
+		s.offset = 0
+		if err := s.file.Truncate(0); err != nil {
+			return domains, err
+		}
+	}
+	if s.offset == start {
+		return domains, nil
+	}
+	return domains, s.saveOffset()
+}
+
+func (s *spillFile) pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.count
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SpillTestSuite struct {
+	suite.Suite
+	path  string
+	spill *spillFile
+}
+
+func (suite *SpillTestSuite) SetupTest() {
+	suite.path = filepath.Join(suite.T().TempDir(), "queue.spill")
+	suite.spill = &spillFile{path: suite.path}
+}
+
+func (suite *SpillTestSuite) TearDownTest() {
+	if suite.spill.file != nil {
+		suite.NoError(suite.spill.file.Close())
+	}
+}
+
+func (suite *SpillTestSuite) TestWriteRead() {
+	suite.NoError(suite.spill.write("a.example.com"))
+	suite.NoError(suite.spill.write("b.example.com"))
+	suite.Equal(2, suite.spill.pending())
+
+	domains, err := suite.spill.read(1)
+	suite.NoError(err)
+	suite.Equal([]string{"a.example.com"}, domains)
+
+	// Writes after a partial read are appended behind the unread lines
+	suite.NoError(suite.spill.write("c.example.com"))
+	domains, err = suite.spill.read(10)
+	suite.NoError(err)
+	suite.Equal([]string{"b.example.com", "c.example.com"}, domains)
+	suite.Equal(0, suite.spill.pending())
+
+	info, err := os.Stat(suite.path)
+	suite.NoError(err)
+	suite.Equal(int64(0), info.Size())
+}
+
+func (suite *SpillTestSuite) TestReadZero() {
+	suite.NoError(suite.spill.write("a.example.com"))
+	domains, err := suite.spill.read(0)
+	suite.NoError(err)
+	suite.Empty(domains)
+	suite.Equal(1, suite.spill.pending())
+}
+
+func (suite *SpillTestSuite) TestPartialLine() {
+	// A crash mid-write leaves a line without a newline, which is never returned
+	suite.NoError(os.WriteFile(suite.path, []byte("a.example.com\nb.exam"), 0o600))
+	domains, err := suite.spill.read(10)
+	suite.NoError(err)
+	suite.Equal([]string{"a.example.com"}, domains)
+	suite.Equal(0, suite.spill.pending())
+}
+
+func (suite *SpillTestSuite) TestReopenAfterPartialRead() {
+	for _, domain := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		suite.NoError(suite.spill.write(domain))
+	}
+	domains, err := suite.spill.read(2)
+	suite.NoError(err)
+	suite.Equal([]string{"a.example.com", "b.example.com"}, domains)
+	suite.NoError(suite.spill.file.Close())
+
+	// A restart only sees what wasn't read yet
+	suite.spill = &spillFile{path: suite.path}
+	suite.NoError(suite.spill.write("d.example.com"))
+	suite.Equal(2, suite.spill.pending())
+	domains, err = suite.spill.read(10)
+	suite.NoError(err)
+	suite.Equal([]string{"c.example.com", "d.example.com"}, domains)
+
+	// Draining the file forgets the offset
+	suite.NoFileExists(suite.path + ".offset")
+	suite.NoError(suite.spill.file.Close())
+	suite.spill = &spillFile{path: suite.path}
+	domains, err = suite.spill.read(10)
+	suite.NoError(err)
+	suite.Empty(domains)
+}
+
+func (suite *SpillTestSuite) TestStaleOffset() {
+	// An offset past the end, or not at the start of a line, is ignored
+	for _, offset := range []string{"100\n", "3\n", "junk\n"} {
+		suite.NoError(os.WriteFile(suite.path, []byte("a.example.com\nb.example.com\n"), 0o600))
+		suite.NoError(os.WriteFile(suite.path+".offset", []byte(offset), 0o600))
+		spill := &spillFile{path: suite.path}
+		domains, err := spill.read(10)
+		suite.NoError(err)
+		suite.Equal([]string{"a.example.com", "b.example.com"}, domains, offset)
+		suite.NoError(spill.file.Close())
+	}
+}
+
+func TestSpillTestSuite(t *testing.T) {
+	suite.Run(t, new(SpillTestSuite))
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/weppos/publicsuffix-go/publicsuffix"
+)
+
+const (
+	RejectUnknownSuffix = "unknown-suffix"
+	RejectPublicSuffix  = "public-suffix"
+)
+
+// suffixFindOptions finds only listed rules, unlike the PSL algorithm's default "*" rule
+// that accepts any TLD.
+var suffixFindOptions = &publicsuffix.FindOptions{}
+
+// WithPublicSuffixList rejects names whose suffix isn't in list and names that are a public suffix
+// themselves, like co.uk or github.io.
+func WithPublicSuffixList(list *publicsuffix.List) QueueOption {
+	return func(q *DomainQueue) {
+		q.suffixes = list
+	}
+}
+
+// WithRegisteredDomains collapses every name to its registered domain, eTLD+1, before deduplication,
+// so www.example.co.uk is queued as example.co.uk. It implies WithPublicSuffixList, using the
+// embedded list unless another one is given.
+func WithRegisteredDomains() QueueOption {
+	return func(q *DomainQueue) {
+		q.registeredOnly = true
+	}
+}
+
+// LoadPublicSuffixList reads a list in the publicsuffix.org format, including the private domains.
+func LoadPublicSuffixList(path string) (*publicsuffix.List, error) {
+	return publicsuffix.NewListFromFile(path, &publicsuffix.ParserOption{PrivateDomains: true})
+}
+
+// suffixName is the suffix stage, it checks the name against the public suffix list and
+// collapses it to its registered domain with WithRegisteredDomains.
+func (q *DomainQueue) suffixName(name *Name) string {
+	rule := q.suffixes.Find(name.Domain, suffixFindOptions)
+	if rule == nil {
+		return RejectUnknownSuffix
+	}
+	parts := rule.Decompose(name.Domain)
+	if parts[1] == "" {
+		return RejectPublicSuffix
+	}
+	if q.registeredOnly {
+		// The registered domain is the suffix and the label before it
+		left := parts[0][strings.LastIndexByte(parts[0], '.')+1:]
+		name.Domain = left + "." + parts[1]
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/weppos/publicsuffix-go/publicsuffix"
+)
+
+type SuffixTestSuite struct {
+	suite.Suite
+	cache *MockCache
+}
+
+func (suite *SuffixTestSuite) SetupTest() {
+	suite.cache = NewMockCache()
+}
+
+func (suite *SuffixTestSuite) TestFilter() {
+	queue := NewDomainQueue(suite.cache, 3600, WithPublicSuffixList(publicsuffix.DefaultList))
+	for _, domain := range []string{
+		"www.example.com", "example.co.uk", "user.github.io", "пример.рф", "1.2.0.192.in-addr.arpa",
+		"co.uk", "github.io", "com", "example.notatld", "printer.lan",
+	} {
+		queue.Add(domain)
+	}
+	suite.ElementsMatch([]string{
+		"www.example.com", "example.co.uk", "user.github.io", "xn--e1afmkfd.xn--p1ai", "1.2.0.192.in-addr.arpa",
+	}, queue.Get())
+	suite.Equal(map[string]uint64{
+		RejectPublicSuffix:  2,
+		RejectInvalid:       1, // A bare TLD isn't even a valid name
+		RejectUnknownSuffix: 2,
+	}, queue.Stats().Rejected)
+}
+
+func (suite *SuffixTestSuite) TestRegisteredDomains() {
+	queue := NewDomainQueue(suite.cache, 3600, WithRegisteredDomains())
+	for _, domain := range []string{
+		"www.example.com", "mail.example.com", "a.b.c.example.co.uk", "user.github.io", "cdn.user.github.io",
+		"www.пример.рф", "host.example.notatld",
+	} {
+		queue.Add(domain)
+	}
+	suite.ElementsMatch([]string{"example.com", "example.co.uk", "user.github.io", "xn--e1afmkfd.xn--p1ai"}, queue.Get())
+	suite.Equal(map[string]uint64{RejectUnknownSuffix: 1}, queue.Stats().Rejected)
+}
+
+func (suite *SuffixTestSuite) TestRegisteredDomainsUnicodeForm() {
+	queue := NewDomainQueue(suite.cache, 3600, WithRegisteredDomains(), WithUnicodeForm())
+	queue.Add("www.пример.рф")
+	suite.ElementsMatch([]string{"xn--e1afmkfd.xn--p1ai", "пример.рф"}, queue.Get())
+}
+
+func (suite *SuffixTestSuite) TestLoadFromFile() {
+	path := filepath.Join(suite.T().TempDir(), "public_suffix_list.dat")
+	content := "// ===BEGIN ICANN DOMAINS===\ncom\nuk\nco.uk\n*.ck\n!www.ck\nрф\n" +
+		"// ===BEGIN PRIVATE DOMAINS===\nexample-hosting.com\n"
+	suite.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	list, err := LoadPublicSuffixList(path)
+	suite.Require().NoError(err)
+
+	queue := NewDomainQueue(suite.cache, 3600, WithPublicSuffixList(list), WithRegisteredDomains())
+	for _, domain := range []string{
+		"www.example.com", "shop.example.co.uk", "site.example-hosting.com", "a.b.foo.ck", "www.ck",
+		"www.пример.рф", "example.org", "foo.ck",
+	} {
+		queue.Add(domain)
+	}
+	suite.ElementsMatch([]string{
+		"example.com", "example.co.uk", "site.example-hosting.com", "b.foo.ck", "www.ck", "xn--e1afmkfd.xn--p1ai",
+	}, queue.Get())
+	suite.Equal(map[string]uint64{RejectUnknownSuffix: 1, RejectPublicSuffix: 1}, queue.Stats().Rejected)
+}
+
+func (suite *SuffixTestSuite) TestLoadMissingFile() {
+	_, err := LoadPublicSuffixList(filepath.Join(suite.T().TempDir(), "missing.dat"))
+	suite.Error(err)
+}
+
+func TestSuffixTestSuite(t *testing.T) {
+	suite.Run(t, new(SuffixTestSuite))
+}
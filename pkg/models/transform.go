@@ -0,0 +1,25 @@
+package models
+
+// Transformer rewrites a name as the source reported it, before it's normalized, e.g. to remove
+// identifiers. The result goes through the same validation as any other name.
+type Transformer interface {
+	Transform(domain string) string
+}
+
+// WithTransformer applies transformer to every name in the transform stage, before anything else.
+func WithTransformer(transformer Transformer) QueueOption {
+	return func(q *DomainQueue) {
+		q.transformer = transformer
+	}
+}
+
+// transformName returns the transform stage. Names rewritten after normalization are normalized again.
+func transformName(transformer Transformer) Processor {
+	return ProcessorFunc(func(name *Name) string {
+		name.Domain = transformer.Transform(name.Domain)
+		if name.normalized {
+			return normalizeName(name)
+		}
+		return ""
+	})
+}
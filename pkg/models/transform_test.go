@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// prefixTransformer drops a fixed first label.
+type prefixTransformer string
+
+func (t prefixTransformer) Transform(domain string) string {
+	return strings.TrimPrefix(domain, string(t)+".")
+}
+
+type TransformTestSuite struct {
+	suite.Suite
+	queue *DomainQueue
+}
+
+func (suite *TransformTestSuite) SetupTest() {
+	filter := suffixFilter{suffix: "tracker.example.com"}
+	suite.queue = NewDomainQueue(NewMockCache(), 3600, WithTransformer(prefixTransformer("user42")), WithNameFilter(filter))
+}
+
+func (suite *TransformTestSuite) TestTransformBeforeDedupe() {
+	suite.queue.Add("user42.www.example.com")
+	suite.queue.Add("www.example.com")
+	suite.Equal([]string{"www.example.com"}, suite.queue.Get())
+}
+
+func (suite *TransformTestSuite) TestTransformBeforeValidation() {
+	// The raw name isn't valid, the transformed one is
+	suite.queue.Add("user42.www.example.org")
+	suite.queue.Add("user42")
+	suite.queue.Add("user42.tracker.example.com")
+	suite.Equal([]string{"www.example.org"}, suite.queue.Get())
+	suite.Equal(map[string]uint64{RejectInvalid: 1, "denied": 1}, suite.queue.Stats().Rejected)
+}
+
+func TestTransformTestSuite(t *testing.T) {
+	suite.Run(t, new(TransformTestSuite))
+}
@@ -0,0 +1,117 @@
+package privacy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Detector reports whether a label looks like it carries an identifier.
+type Detector func(label string) bool
+
+const (
+	minHashLength    = 16
+	minEntropyLength = 20
+	// minEntropy is in bits per character, random base32 is close to 4, words and hostnames stay well below.
+	minEntropy = 3.5
+)
+
+// Detectors are the built-in detectors by name.
+var Detectors = map[string]Detector{
+	"hash":    IsHash,
+	"uuid":    IsUUID,
+	"email":   IsEmail,
+	"entropy": IsHighEntropy,
+}
+
+// ParseDetectors parses a comma separated list of detector names.
+func ParseDetectors(list string) ([]Detector, error) {
+	var detectors []Detector
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		detector, ok := Detectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q, expected hash, uuid, email or entropy", name)
+		}
+		detectors = append(detectors, detector)
+	}
+	return detectors, nil
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// IsHash matches hex strings of at least 16 characters, like MD5 and SHA-1 digests.
+func IsHash(label string) bool {
+	if len(label) < minHashLength {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		if !isHex(label[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsUUID matches the 8-4-4-4-12 hex form, the form without hyphens is a hash.
+func IsUUID(label string) bool {
+	if len(label) != 36 {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if label[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(label[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsEmail matches labels holding an @, plain or URL encoded. It only sees them in names
+// from logs, as they are never valid on the wire.
+func IsEmail(label string) bool {
+	return strings.Contains(label, "@") || strings.Contains(strings.ToLower(label), "%40")
+}
+
+// IsHighEntropy matches long labels mixing letters and digits with a character distribution
+// close to random, like base32 and base64 encoded tokens.
+func IsHighEntropy(label string) bool {
+	if len(label) < minEntropyLength {
+		return false
+	}
+	var counts [256]int
+	letters, digits := false, false
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		counts[c]++
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			letters = true
+		}
+	}
+	if !letters || !digits {
+		return false
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(label))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minEntropy
+}
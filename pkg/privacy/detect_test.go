@@ -0,0 +1,53 @@
+package privacy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DetectTestSuite struct {
+	suite.Suite
+}
+
+func (suite *DetectTestSuite) TestDetectors() {
+	for _, tc := range []struct {
+		label    string
+		detector string
+		matched  bool
+	}{
+		{"d41d8cd98f00b204e9800998ecf8427e", "hash", true},
+		{"DA39A3EE5E6B4B0D3255BFEF95601890AFD80709", "hash", true},
+		{"deadbeef", "hash", false},
+		{"d41d8cd98f00b204e9800998ecf8427g", "hash", false},
+		{"123e4567-e89b-12d3-a456-426614174000", "uuid", true},
+		{"123e4567e89b12d3a456426614174000", "uuid", false},
+		{"123e4567-e89b-12d3-a456-42661417400z", "uuid", false},
+		{"john@example", "email", true},
+		{"john%40example", "email", true},
+		{"johnexample", "email", false},
+		{"mfrggzdfmztwq2lknnwg23tpobyxe43u", "entropy", true},
+		{"aGVsbG8gd29ybGQgdGhpcyBpcyBh", "entropy", true},
+		{"thisisaverylonghostnamewithoutdigits", "entropy", false},
+		{"r3---sn-5hne6nsk", "entropy", false},
+		{"ec2-54-210-111-23-compute-1", "entropy", false},
+		{"www", "entropy", false},
+	} {
+		suite.Equal(tc.matched, Detectors[tc.detector](tc.label), "%s %s", tc.detector, tc.label)
+	}
+}
+
+func (suite *DetectTestSuite) TestParseDetectors() {
+	detectors, err := ParseDetectors("hash, uuid,email,entropy")
+	suite.NoError(err)
+	suite.Len(detectors, 4)
+	detectors, err = ParseDetectors("")
+	suite.NoError(err)
+	suite.Empty(detectors)
+	_, err = ParseDetectors("hash,phone")
+	suite.ErrorContains(err, "phone")
+}
+
+func TestDetectTestSuite(t *testing.T) {
+	suite.Run(t, new(DetectTestSuite))
+}
@@ -0,0 +1,202 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+const (
+	DefaultPlaceholder = "redacted"
+	// hashedLabelBytes of the HMAC are kept, 32 hex characters.
+	hashedLabelBytes = 16
+)
+
+type Config struct {
+	Strip       map[string]int // Zone -> number of leftmost labels to strip from names under it
+	HMACZones   []string       // Names under these zones have their labels below the zone hashed
+	HMACKey     []byte         // Required with HMACZones
+	Detectors   []Detector     // Labels matching any of these are replaced with the placeholder
+	Placeholder string
+}
+
+// Privacy rewrites names so they don't disclose identifiers before they are queued.
+// Zones are the name and everything under it, matched in lowercase A-label form.
+type Privacy struct {
+	strip       map[string]int
+	hmacZones   map[string]struct{}
+	key         []byte
+	detectors   []Detector
+	placeholder string
+}
+
+// zoneOf returns the longest zone in zones that name is in or equal to, or "".
+func zoneOf[V any](name string, zones map[string]V) string {
+	for suffix := name; ; {
+		if _, ok := zones[suffix]; ok {
+			return suffix
+		}
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			return ""
+		}
+		suffix = suffix[i+1:]
+	}
+}
+
+// Transform returns name with the configured rules applied. Stripping comes first, then names under
+// an HMAC zone are hashed, and the labels of any other name are checked by the detectors.
+func (p *Privacy) Transform(name string) string {
+	// Match zones on the canonical form, names that don't convert are left for the queue to reject
+	lower := strings.ToLower(name)
+	if utils.IsIDN(name) {
+		if ascii, err := utils.ToASCII(name); err == nil {
+			lower = ascii
+		}
+	}
+	if zone := zoneOf(lower, p.strip); zone != "" {
+		lower = stripLabels(lower, zone, p.strip[zone])
+		name = lower
+	}
+	if zone := zoneOf(lower, p.hmacZones); zone != "" {
+		if len(lower) == len(zone) {
+			return lower
+		}
+		mac := hmac.New(sha256.New, p.key)
+		mac.Write([]byte(lower[:len(lower)-len(zone)-1]))
+		return hex.EncodeToString(mac.Sum(nil)[:hashedLabelBytes]) + "." + zone
+	}
+	if len(p.detectors) == 0 {
+		return name
+	}
+	return p.redact(name)
+}
+
+// stripLabels removes up to count leftmost labels of name, keeping at least the zone.
+func stripLabels(name, zone string, count int) string {
+	for ; count > 0 && len(name) > len(zone); count-- {
+		name = name[strings.IndexByte(name, '.')+1:]
+	}
+	return name
+}
+
+// redact replaces the labels any detector matches, collapsing consecutive ones into one placeholder.
+// The labels left of a redacted email address are redacted too, they are the rest of its local part,
+// e.g. john in john.doe@example.com.
+func (p *Privacy) redact(name string) string {
+	labels := strings.Split(name, ".")
+	result := labels[:0]
+	redacted := false
+	for _, label := range labels {
+		if !p.detect(label) {
+			result = append(result, label)
+			redacted = false
+			continue
+		}
+		if IsEmail(label) {
+			result, redacted = result[:0], false
+		}
+		if !redacted {
+			result = append(result, p.placeholder)
+		}
+		redacted = true
+	}
+	return strings.Join(result, ".")
+}
+
+func (p *Privacy) detect(label string) bool {
+	for _, detector := range p.detectors {
+		if detector(label) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeZone returns the lowercase A-label form of a configured zone.
+func normalizeZone(zone string) (string, error) {
+	ascii, err := utils.ToASCII(strings.Trim(strings.TrimSpace(zone), "."))
+	if err != nil {
+		return "", err
+	}
+	if ascii == "" {
+		return "", errors.New("empty zone")
+	}
+	return ascii, nil
+}
+
+// New validates config and returns a Privacy transformer for the queue.
+func New(config Config) (*Privacy, error) {
+	p := &Privacy{
+		strip:       make(map[string]int),
+		hmacZones:   make(map[string]struct{}),
+		key:         config.HMACKey,
+		detectors:   config.Detectors,
+		placeholder: config.Placeholder,
+	}
+	if p.placeholder == "" {
+		p.placeholder = DefaultPlaceholder
+	}
+	for zone, count := range config.Strip {
+		normalized, err := normalizeZone(zone)
+		if err != nil {
+			return nil, fmt.Errorf("strip zone %q: %w", zone, err)
+		}
+		if count < 1 {
+			return nil, fmt.Errorf("strip zone %q: label count must be positive", zone)
+		}
+		p.strip[normalized] = count
+	}
+	for _, zone := range config.HMACZones {
+		normalized, err := normalizeZone(zone)
+		if err != nil {
+			return nil, fmt.Errorf("HMAC zone %q: %w", zone, err)
+		}
+		p.hmacZones[normalized] = struct{}{}
+	}
+	if len(p.hmacZones) > 0 && len(p.key) == 0 {
+		return nil, errors.New("HMAC zones need a key")
+	}
+	return p, nil
+}
+
+// ParseStrip parses a comma separated list of zone:count pairs, e.g. avqs.mcafee.com:4.
+func ParseStrip(list string) (map[string]int, error) {
+	strip := make(map[string]int)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		zone, count, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid strip rule %q, expected zone:count", field)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("invalid strip rule %q: %w", field, err)
+		}
+		strip[zone] = n
+	}
+	return strip, nil
+}
+
+// LoadKey reads an HMAC key from a file, surrounding whitespace is ignored.
+func LoadKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) < 16 {
+		return nil, fmt.Errorf("%s: key must be at least 16 bytes", path)
+	}
+	return key, nil
+}
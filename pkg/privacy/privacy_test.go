@@ -0,0 +1,133 @@
+package privacy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+)
+
+var _ models.Transformer = (*Privacy)(nil)
+
+type PrivacyTestSuite struct {
+	suite.Suite
+	key []byte
+}
+
+func (suite *PrivacyTestSuite) SetupTest() {
+	suite.key = []byte("0123456789abcdef")
+}
+
+func (suite *PrivacyTestSuite) newPrivacy(config Config) *Privacy {
+	p, err := New(config)
+	suite.Require().NoError(err)
+	return p
+}
+
+func (suite *PrivacyTestSuite) TestStrip() {
+	p := suite.newPrivacy(Config{Strip: map[string]int{"avqs.mcafee.com": 2, "Tracker.Example.net.": 1}})
+	for name, expected := range map[string]string{
+		"0.0.1.4e.13cifr.avqs.mcafee.com": "1.4e.13cifr.avqs.mcafee.com",
+		"a.b.avqs.mcafee.com":             "avqs.mcafee.com",
+		"a.avqs.mcafee.com":               "avqs.mcafee.com", // Never past the zone
+		"avqs.mcafee.com":                 "avqs.mcafee.com",
+		"User42.TRACKER.example.net":      "tracker.example.net",
+		"www.mcafee.com":                  "www.mcafee.com",
+	} {
+		suite.Equal(expected, p.Transform(name), name)
+	}
+}
+
+func (suite *PrivacyTestSuite) TestHMAC() {
+	p := suite.newPrivacy(Config{HMACZones: []string{"corp.example.com"}, HMACKey: suite.key})
+	hashed := p.Transform("laptop-jdoe.corp.example.com")
+	suite.Regexp(`^[0-9a-f]{32}\.corp\.example\.com$`, hashed)
+	// Stable per key and case insensitive, so hashed names still dedupe
+	suite.Equal(hashed, p.Transform("Laptop-JDoe.Corp.Example.com"))
+	suite.NotEqual(hashed, p.Transform("laptop-asmith.corp.example.com"))
+	suite.Equal("corp.example.com", p.Transform("corp.example.com"))
+	suite.Equal("laptop-jdoe.example.com", p.Transform("laptop-jdoe.example.com"))
+
+	other := suite.newPrivacy(Config{HMACZones: []string{"corp.example.com"}, HMACKey: []byte("another key 1234")})
+	suite.NotEqual(hashed, other.Transform("laptop-jdoe.corp.example.com"))
+}
+
+func (suite *PrivacyTestSuite) TestRedact() {
+	p := suite.newPrivacy(Config{Detectors: []Detector{IsHash, IsUUID, IsEmail, IsHighEntropy}})
+	for name, expected := range map[string]string{
+		"d41d8cd98f00b204e9800998ecf8427e.ebl.example.org":              "redacted.ebl.example.org",
+		"123e4567-e89b-12d3-a456-426614174000.t.example.com":            "redacted.t.example.com",
+		"john@corp.com.rep.example.net":                                 "redacted.com.rep.example.net",
+		"john.doe@example.com.tracker.net":                              "redacted.com.tracker.net",
+		"a.john.q.doe%40example.com.tracker.net":                        "redacted.com.tracker.net",
+		"mfrggzdfmztwq2lknnwg23tpobyxe43u.d41d8cd98f00b204.example.com": "redacted.example.com",
+		"www.example.com": "www.example.com",
+	} {
+		suite.Equal(expected, p.Transform(name), name)
+	}
+
+	p = suite.newPrivacy(Config{Detectors: []Detector{IsHash}, Placeholder: "x"})
+	suite.Equal("x.example.com", p.Transform("d41d8cd98f00b204e9800998ecf8427e.example.com"))
+}
+
+func (suite *PrivacyTestSuite) TestOrder() {
+	p := suite.newPrivacy(Config{
+		Strip:     map[string]int{"corp.example.com": 1},
+		HMACZones: []string{"corp.example.com"},
+		HMACKey:   suite.key,
+		Detectors: []Detector{IsHash},
+	})
+	hmacOnly := suite.newPrivacy(Config{HMACZones: []string{"corp.example.com"}, HMACKey: suite.key})
+	// Stripped first, then hashed, and the hash isn't redacted
+	hashed := p.Transform("d41d8cd98f00b204e9800998ecf8427e.laptop.corp.example.com")
+	suite.Equal(hmacOnly.Transform("laptop.corp.example.com"), hashed)
+	suite.Regexp(`^[0-9a-f]{32}\.corp\.example\.com$`, hashed)
+}
+
+func (suite *PrivacyTestSuite) TestIDNZone() {
+	p := suite.newPrivacy(Config{Strip: map[string]int{"пример.рф": 1}})
+	suite.Equal("xn--e1afmkfd.xn--p1ai", p.Transform("user.пример.рф"))
+	suite.Equal("xn--e1afmkfd.xn--p1ai", p.Transform("user.xn--e1afmkfd.xn--p1ai"))
+}
+
+func (suite *PrivacyTestSuite) TestInvalidConfig() {
+	for _, config := range []Config{
+		{HMACZones: []string{"corp.example.com"}},
+		{Strip: map[string]int{"example.com": 0}},
+		{Strip: map[string]int{"": 1}},
+		{HMACZones: []string{"xn--zz.com"}, HMACKey: suite.key},
+	} {
+		_, err := New(config)
+		suite.Error(err, "%+v", config)
+	}
+}
+
+func (suite *PrivacyTestSuite) TestParseStrip() {
+	strip, err := ParseStrip("avqs.mcafee.com:4, tracker.example.net:1")
+	suite.NoError(err)
+	suite.Equal(map[string]int{"avqs.mcafee.com": 4, "tracker.example.net": 1}, strip)
+	_, err = ParseStrip("avqs.mcafee.com")
+	suite.Error(err)
+	_, err = ParseStrip("avqs.mcafee.com:four")
+	suite.Error(err)
+}
+
+func (suite *PrivacyTestSuite) TestLoadKey() {
+	path := filepath.Join(suite.T().TempDir(), "hmac.key")
+	suite.Require().NoError(os.WriteFile(path, []byte("0123456789abcdef0123\n"), 0o600))
+	key, err := LoadKey(path)
+	suite.NoError(err)
+	suite.Equal([]byte("0123456789abcdef0123"), key)
+
+	suite.Require().NoError(os.WriteFile(path, []byte("short\n"), 0o600))
+	_, err = LoadKey(path)
+	suite.Error(err)
+	_, err = LoadKey(filepath.Join(suite.T().TempDir(), "missing.key"))
+	suite.Error(err)
+}
+
+func TestPrivacyTestSuite(t *testing.T) {
+	suite.Run(t, new(PrivacyTestSuite))
+}
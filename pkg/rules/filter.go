@@ -0,0 +1,153 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultReloadInterval = 10 * time.Second
+)
+
+type Config struct {
+	DenyFile       string        // Optional
+	AllowFile      string        // Optional
+	SpecialUse     bool          // Deny the built-in special-use and private names
+	ReloadInterval time.Duration // How often the files are checked for changes
+}
+
+// Filter applies rules loaded from files and reloads them when the files change or on SIGHUP.
+// A file that fails to load keeps the previous rules in place. It satisfies sources.Source,
+// Start runs the reload loop.
+type Filter struct {
+	config   Config
+	rules    atomic.Pointer[Rules]
+	lock     sync.Mutex // Guards modified
+	modified map[string]time.Time
+	logger   zerolog.Logger
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Check returns why name, seen from client, must not be submitted, or "" if it may be.
+func (f *Filter) Check(name, client string) string {
+	return f.rules.Load().Check(name, client)
+}
+
+// modTimes returns the modification time of every configured file.
+func (f *Filter) modTimes() map[string]time.Time {
+	modified := make(map[string]time.Time)
+	for _, path := range []string{f.config.DenyFile, f.config.AllowFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modified[path] = info.ModTime()
+		}
+	}
+	return modified
+}
+
+// changed reports whether a file was modified, created or removed since the last load.
+func (f *Filter) changed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	modified := f.modTimes()
+	if len(modified) != len(f.modified) {
+		return true
+	}
+	for path, modTime := range modified {
+		if !modTime.Equal(f.modified[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload loads the files and swaps in the new rules.
+func (f *Filter) Reload() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	modified := f.modTimes()
+	rules := &Rules{}
+	if f.config.SpecialUse {
+		rules.SpecialUse = SpecialUse()
+	}
+	var err error
+	if f.config.DenyFile != "" {
+		if rules.Deny, err = LoadFile(f.config.DenyFile); err != nil {
+			return err
+		}
+	}
+	if f.config.AllowFile != "" {
+		if rules.Allow, err = LoadFile(f.config.AllowFile); err != nil {
+			return err
+		}
+	}
+	f.rules.Store(rules)
+	f.modified = modified
+	return nil
+}
+
+func (f *Filter) reload(trigger string) {
+	if err := f.Reload(); err != nil {
+		f.logger.Error().Err(err).Msg("Failed to reload rules, keeping the previous ones")
+		return
+	}
+	f.logger.Info().Str("trigger", trigger).Msg("Reloaded rules")
+}
+
+// Start reloads the rules when a file changes or SIGHUP is received, until Stop is called.
+func (f *Filter) Start() error {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(f.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return nil
+		case <-hangup:
+			f.reload("SIGHUP")
+		case <-ticker.C:
+			if f.changed() {
+				f.reload("file change")
+			}
+		}
+	}
+}
+
+func (f *Filter) Stop(ctx context.Context) error {
+	f.stopOnce.Do(func() {
+		close(f.done)
+	})
+	return nil
+}
+
+// NewFilter loads the rules, a file that doesn't load is an error here, unlike on reload.
+func NewFilter(config Config, logger zerolog.Logger) (*Filter, error) {
+	if config.DenyFile == "" && config.AllowFile == "" && !config.SpecialUse {
+		return nil, errors.New("no rules configured")
+	}
+	if config.ReloadInterval <= 0 {
+		config.ReloadInterval = DefaultReloadInterval
+	}
+	f := &Filter{
+		config: config,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,115 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+)
+
+var _ models.NameFilter = (*Filter)(nil)
+
+type FilterTestSuite struct {
+	suite.Suite
+	dir       string
+	denyFile  string
+	allowFile string
+	writes    int
+}
+
+func (suite *FilterTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+	suite.denyFile = filepath.Join(suite.dir, "deny.txt")
+	suite.allowFile = filepath.Join(suite.dir, "allow.txt")
+}
+
+// write replaces a rules file and moves its modification time forward, so a reload notices
+// even on filesystems with coarse timestamps.
+func (suite *FilterTestSuite) write(path, content string) {
+	suite.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	suite.writes++
+	modTime := time.Now().Add(time.Duration(suite.writes) * time.Second)
+	suite.Require().NoError(os.Chtimes(path, modTime, modTime))
+}
+
+// start runs the reload loop and returns a function that stops it and checks how it ended, so
+// nothing is left running, or reporting, after the test method returns.
+func (suite *FilterTestSuite) start(filter *Filter) func() {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- filter.Start()
+	}()
+	return func() {
+		suite.NoError(filter.Stop(context.Background()))
+		suite.NoError(<-errs)
+	}
+}
+
+func (suite *FilterTestSuite) TestNewFilter() {
+	_, err := NewFilter(Config{}, zerolog.Nop())
+	suite.Error(err)
+	_, err = NewFilter(Config{DenyFile: suite.denyFile}, zerolog.Nop())
+	suite.Error(err, "missing file")
+
+	suite.write(suite.denyFile, ".corp.example.internal\n")
+	filter, err := NewFilter(Config{DenyFile: suite.denyFile, SpecialUse: true}, zerolog.Nop())
+	suite.Require().NoError(err)
+	suite.Equal(RejectDenied, filter.Check("dc1.corp.example.internal", ""))
+	suite.Equal(RejectSpecialUse, filter.Check("printer.local", ""))
+	suite.Equal("", filter.Check("www.google.com", ""))
+
+	filter, err = NewFilter(Config{DenyFile: suite.denyFile}, zerolog.Nop())
+	suite.Require().NoError(err)
+	suite.Equal(RejectDenied, filter.Check("dc1.corp.example.internal", ""))
+	suite.Equal("", filter.Check("printer.local", ""))
+}
+
+func (suite *FilterTestSuite) TestReloadOnChange() {
+	suite.write(suite.denyFile, "one.example.net\n")
+	suite.write(suite.allowFile, "# Nothing yet\n")
+	filter, err := NewFilter(Config{DenyFile: suite.denyFile, AllowFile: suite.allowFile,
+		ReloadInterval: 10 * time.Millisecond}, zerolog.Nop())
+	suite.Require().NoError(err)
+	defer suite.start(filter)()
+	suite.Equal(RejectDenied, filter.Check("one.example.net", ""))
+
+	suite.write(suite.denyFile, "two.example.net\n")
+	suite.Eventually(func() bool {
+		return filter.Check("two.example.net", "") == RejectDenied
+	}, time.Second, 10*time.Millisecond)
+	suite.Equal("", filter.Check("one.example.net", ""))
+
+	suite.write(suite.allowFile, "192.0.2.0/24\n")
+	suite.Eventually(func() bool {
+		return filter.Check("www.example.com", "198.51.100.1") == RejectClientNotAllowed
+	}, time.Second, 10*time.Millisecond)
+
+	// A broken file keeps the previous rules
+	suite.write(suite.denyFile, "/[/\n")
+	time.Sleep(50 * time.Millisecond)
+	suite.Equal(RejectDenied, filter.Check("two.example.net", ""))
+}
+
+func (suite *FilterTestSuite) TestReloadOnHangup() {
+	suite.write(suite.denyFile, "one.example.net\n")
+	filter, err := NewFilter(Config{DenyFile: suite.denyFile, ReloadInterval: time.Hour}, zerolog.Nop())
+	suite.Require().NoError(err)
+	defer suite.start(filter)()
+
+	suite.write(suite.denyFile, "two.example.net\n")
+	// Signal until the reload loop has installed its handler and picked the change up
+	suite.Eventually(func() bool {
+		suite.Require().NoError(syscall.Kill(os.Getpid(), syscall.SIGHUP))
+		return filter.Check("two.example.net", "") == RejectDenied
+	}, time.Second, 20*time.Millisecond)
+}
+
+func TestFilterTestSuite(t *testing.T) {
+	suite.Run(t, new(FilterTestSuite))
+}
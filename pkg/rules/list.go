@@ -0,0 +1,179 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+// List is a set of name and client rules, one per line:
+//
+//	corp.example.internal   the exact name
+//	.example.internal       the name and all of its subdomains
+//	ads-*.example.net       shell style wildcard, see path.Match
+//	/^[0-9a-f]{32}\./       regular expression between slashes
+//	10.0.0.0/8              client network or address
+//
+// Blank lines and lines starting with # are ignored. Names are matched in lowercase A-label form.
+type List struct {
+	exact    map[string]struct{}
+	suffixes map[string]struct{}
+	globs    []string
+	regexps  []*regexp.Regexp
+	clients  []netip.Prefix
+}
+
+func newList() *List {
+	return &List{
+		exact:    make(map[string]struct{}),
+		suffixes: make(map[string]struct{}),
+	}
+}
+
+// add parses a single rule.
+func (l *List) add(rule string) error {
+	switch {
+	case len(rule) > 2 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/"):
+		re, err := regexp.Compile(rule[1 : len(rule)-1])
+		if err != nil {
+			return err
+		}
+		l.regexps = append(l.regexps, re)
+	case strings.ContainsAny(rule, "*?["):
+		if _, err := path.Match(rule, ""); err != nil {
+			return err
+		}
+		l.globs = append(l.globs, strings.ToLower(rule))
+	case strings.ContainsAny(rule, ":/") || isAddr(rule):
+		prefix, err := parsePrefix(rule)
+		if err != nil {
+			return err
+		}
+		l.clients = append(l.clients, prefix)
+	default:
+		suffix := strings.HasPrefix(rule, ".")
+		name, err := utils.ToASCII(strings.TrimPrefix(rule, "."))
+		if err != nil {
+			return err
+		}
+		if !utils.IsDomain(name) && !isLabel(name) {
+			return fmt.Errorf("invalid name %q", rule)
+		}
+		if suffix {
+			l.suffixes[name] = struct{}{}
+		} else {
+			l.exact[name] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// isLabel allows single label rules like .lan, which IsDomain rejects.
+func isLabel(name string) bool {
+	return !strings.Contains(name, ".") && utils.IsDomain(name+".invalid")
+}
+
+func isAddr(rule string) bool {
+	_, err := netip.ParseAddr(rule)
+	return err == nil
+}
+
+func parsePrefix(rule string) (netip.Prefix, error) {
+	if strings.Contains(rule, "/") {
+		prefix, err := netip.ParsePrefix(rule)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(rule)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// MatchName reports whether name, a lowercase A-label, matches a name rule.
+func (l *List) MatchName(name string) bool {
+	if _, ok := l.exact[name]; ok {
+		return true
+	}
+	for suffix := name; ; {
+		if _, ok := l.suffixes[suffix]; ok {
+			return true
+		}
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+	}
+	for _, glob := range l.globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	for _, re := range l.regexps {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchClient reports whether addr is in a client network.
+func (l *List) MatchClient(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l.clients {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasNames reports whether the list has any name rules.
+func (l *List) HasNames() bool {
+	return len(l.exact) > 0 || len(l.suffixes) > 0 || len(l.globs) > 0 || len(l.regexps) > 0
+}
+
+// HasClients reports whether the list has any client rules.
+func (l *List) HasClients() bool {
+	return len(l.clients) > 0
+}
+
+// Parse reads a list, stopping at the first invalid rule.
+func Parse(r io.Reader) (*List, error) {
+	list := newList()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		rule := strings.TrimSpace(scanner.Text())
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		if err := list.add(rule); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return list, scanner.Err()
+}
+
+func LoadFile(path string) (*List, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	list, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return list, nil
+}
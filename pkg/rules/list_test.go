@@ -0,0 +1,102 @@
+package rules
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ListTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ListTestSuite) parse(rules string) *List {
+	list, err := Parse(strings.NewReader(rules))
+	suite.Require().NoError(err)
+	return list
+}
+
+func (suite *ListTestSuite) TestMatchName() {
+	list := suite.parse(`
+# Exact names
+corp.example.internal
+Tracker.Example.COM
+# Suffixes
+.lan
+.ads.example.net
+.пример.рф
+# Wildcards
+cdn-??.example.org
+*.telemetry.*
+# Regular expressions
+/^[0-9a-f]{32}\./
+`)
+	for name, matched := range map[string]bool{
+		"corp.example.internal":     true,
+		"www.corp.example.internal": false,
+		"tracker.example.com":       true,
+		"printer.lan":               true,
+		"lan":                       true,
+		"ads.example.net":           true,
+		"x.y.ads.example.net":       true,
+		"badads.example.net":        false,
+		"www.xn--e1afmkfd.xn--p1ai": true,
+		"cdn-01.example.org":        true,
+		"cdn-001.example.org":       false,
+		"eu.telemetry.example.com":  true,
+		"telemetry.example.com":     false,
+		"0123456789abcdef0123456789abcdef.avqs.example.com": true,
+		"example.com": false,
+	} {
+		suite.Equal(matched, list.MatchName(name), name)
+	}
+	suite.True(list.HasNames())
+	suite.False(list.HasClients())
+}
+
+func (suite *ListTestSuite) TestMatchClient() {
+	list := suite.parse("10.0.0.0/8\n192.0.2.7\n2001:db8::/32\n192.168.1.77/24\n")
+	for client, matched := range map[string]bool{
+		"10.1.2.3":        true,
+		"11.0.0.1":        false,
+		"192.0.2.7":       true,
+		"192.0.2.8":       false,
+		"::ffff:10.0.0.1": true,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"192.168.1.200":   true, // Host bits are masked
+	} {
+		suite.Equal(matched, list.MatchClient(netip.MustParseAddr(client)), client)
+	}
+	suite.False(list.HasNames())
+	suite.True(list.HasClients())
+}
+
+func (suite *ListTestSuite) TestInvalidRules() {
+	for _, rule := range []string{"/[/", "cdn-[.example.org", "10.0.0.0/33", "not a name", "-bad.example.com", "xn--zz.com"} {
+		_, err := Parse(strings.NewReader("example.com\n" + rule + "\n"))
+		suite.ErrorContains(err, "line 2", rule)
+	}
+}
+
+func (suite *ListTestSuite) TestLoadFile() {
+	path := filepath.Join(suite.T().TempDir(), "deny.txt")
+	suite.Require().NoError(os.WriteFile(path, []byte(".example.internal\n"), 0o600))
+	list, err := LoadFile(path)
+	suite.Require().NoError(err)
+	suite.True(list.MatchName("dc1.example.internal"))
+
+	_, err = LoadFile(filepath.Join(suite.T().TempDir(), "missing.txt"))
+	suite.Error(err)
+	suite.Require().NoError(os.WriteFile(path, []byte("/[/\n"), 0o600))
+	_, err = LoadFile(path)
+	suite.ErrorContains(err, path+": line 1")
+}
+
+func TestListTestSuite(t *testing.T) {
+	suite.Run(t, new(ListTestSuite))
+}
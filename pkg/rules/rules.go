@@ -0,0 +1,97 @@
+package rules
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Reasons returned by Rules.Check.
+const (
+	RejectSpecialUse       = "special-use"
+	RejectDenied           = "denied"
+	RejectClientDenied     = "client-denied"
+	RejectNotAllowed       = "not-allowed"
+	RejectClientNotAllowed = "client-not-allowed"
+)
+
+// specialUse are the names of the IANA Special-Use Domain Names registry (RFC 6761), including
+// .local (RFC 6762), home.arpa (RFC 8375) and .alt (RFC 9476), and the reverse lookup zones, which
+// reveal internal addresses. The registry's example.com, example.net and example.org are left out,
+// they are real domains. Private TLDs like .lan or .corp are up to the deny file.
+const specialUse = `
+.test
+.localhost
+.invalid
+.example
+.local
+.onion
+.alt
+.home.arpa
+.ipv4only.arpa
+.resolver.arpa
+.service.arpa
+.6tisch.arpa
+.in-addr.arpa
+.ip6.arpa
+`
+
+// SpecialUse returns the built-in list of special-use names.
+func SpecialUse() *List {
+	list, err := Parse(strings.NewReader(specialUse))
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+// Rules combine deny and allow lists. Denials win, and a non-empty allow list only lets through
+// what it matches. Client rules only apply when the client is known.
+type Rules struct {
+	SpecialUse *List // Optional, see SpecialUse
+	Deny       *List // Optional
+	Allow      *List // Optional
+}
+
+// Check returns why name, seen from client, must not be submitted, or "" if it may be.
+// The client is an address with or without a port and may be empty.
+func (r *Rules) Check(name, client string) string {
+	if r.SpecialUse != nil && r.SpecialUse.MatchName(name) {
+		return RejectSpecialUse
+	}
+	if r.Deny != nil && r.Deny.MatchName(name) {
+		return RejectDenied
+	}
+	if r.Allow != nil && r.Allow.HasNames() && !r.Allow.MatchName(name) {
+		return RejectNotAllowed
+	}
+	denyClients := r.Deny != nil && r.Deny.HasClients()
+	allowClients := r.Allow != nil && r.Allow.HasClients()
+	if !denyClients && !allowClients {
+		return ""
+	}
+	addr, ok := parseClient(client)
+	if !ok {
+		return ""
+	}
+	if denyClients && r.Deny.MatchClient(addr) {
+		return RejectClientDenied
+	}
+	if allowClients && !r.Allow.MatchClient(addr) {
+		return RejectClientNotAllowed
+	}
+	return ""
+}
+
+// parseClient accepts an address or an address and port.
+func parseClient(client string) (netip.Addr, bool) {
+	if client == "" {
+		return netip.Addr{}, false
+	}
+	if addr, err := netip.ParseAddr(client); err == nil {
+		return addr, true
+	}
+	if addrPort, err := netip.ParseAddrPort(client); err == nil {
+		return addrPort.Addr(), true
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,71 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RulesTestSuite struct {
+	suite.Suite
+}
+
+func (suite *RulesTestSuite) parse(rules string) *List {
+	list, err := Parse(strings.NewReader(rules))
+	suite.Require().NoError(err)
+	return list
+}
+
+func (suite *RulesTestSuite) TestSpecialUse() {
+	rules := &Rules{SpecialUse: SpecialUse()}
+	for _, name := range []string{
+		"foo.test", "app.localhost", "x.invalid", "www.example", "printer.local", "abc.onion",
+		"nas.home.arpa", "ipv4only.arpa", "1.2.0.192.in-addr.arpa", "b.a.9.8.ip6.arpa",
+	} {
+		suite.Equal(RejectSpecialUse, rules.Check(name, ""), name)
+	}
+	// Real domains and private TLDs outside the registry are left to the deny file
+	for _, name := range []string{
+		"www.google.com", "examples.com", "www.example.com", "corp.example.internal", "router.lan", "nas.home", "dc.corp",
+	} {
+		suite.Equal("", rules.Check(name, ""), name)
+	}
+}
+
+func (suite *RulesTestSuite) TestDenyAllow() {
+	rules := &Rules{
+		Deny:  suite.parse(".secret.example.net\n10.66.0.0/16\n"),
+		Allow: suite.parse(".example.net\n.example.org\n10.0.0.0/8\n"),
+	}
+	for _, tc := range []struct {
+		name, client, reason string
+	}{
+		{"www.example.net", "10.1.1.1", ""},
+		{"www.example.net", "", ""}, // Client rules don't apply without a client
+		{"www.example.net", "10.1.1.1:53124", ""},
+		{"www.example.net", "[2001:db8::1]:53", RejectClientNotAllowed},
+		{"db.secret.example.net", "10.1.1.1", RejectDenied}, // Deny wins over allow
+		{"www.example.net", "10.66.1.1", RejectClientDenied},
+		{"www.example.com", "10.1.1.1", RejectNotAllowed},
+		{"www.example.org", "192.0.2.1", RejectClientNotAllowed},
+		{"www.example.org", "not an address", ""},
+	} {
+		suite.Equal(tc.reason, rules.Check(tc.name, tc.client), "%s from %s", tc.name, tc.client)
+	}
+}
+
+func (suite *RulesTestSuite) TestClientsOnly() {
+	// An allow list of clients alone doesn't restrict names
+	rules := &Rules{Allow: suite.parse("192.0.2.0/24\n")}
+	suite.Equal("", rules.Check("www.example.com", "192.0.2.1"))
+	suite.Equal(RejectClientNotAllowed, rules.Check("www.example.com", "198.51.100.1"))
+}
+
+func (suite *RulesTestSuite) TestEmpty() {
+	suite.Equal("", (&Rules{}).Check("www.example.com", "192.0.2.1"))
+}
+
+func TestRulesTestSuite(t *testing.T) {
+	suite.Run(t, new(RulesTestSuite))
+}
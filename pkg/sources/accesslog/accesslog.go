@@ -0,0 +1,65 @@
+package accesslog
+
+import (
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+const (
+	DefaultLogFile = "/var/log/squid/access.log"
+)
+
+// ParseLine parses a single forward proxy access log line. Rather than tying itself to one format it
+// looks for a request method followed by a target, which covers the Squid native log:
+//
+//	1286536308.779    180 192.0.2.10 TCP_TUNNEL/200 4012 CONNECT www.example.com:443 - HIER_DIRECT/203.0.113.1 -
+//
+// as well as the quoted request line of nginx combined and HAProxy HTTP logs:
+//
+//	192.0.2.10 - - [10/Oct/2024:13:55:36 +0000] "GET http://www.example.com/ HTTP/1.1" 200 612 "-" "curl/8.5.0"
+//
+// Only CONNECT and absolute URI requests name a destination host, plain origin requests are skipped.
+// The client is the first field holding an IP address, with or without a port.
+func ParseLine(line string) []types.Observation {
+	fields := strings.Fields(line)
+	var client string
+	for i, field := range fields {
+		if client == "" {
+			client = clientAddress(field)
+		}
+		method := strings.TrimPrefix(field, `"`)
+		if !utils.HTTPMethods[method] || i+1 >= len(fields) {
+			continue
+		}
+		host := utils.HostFromRequestTarget(method, strings.TrimSuffix(fields[i+1], `"`))
+		if host == "" {
+			continue
+		}
+		return []types.Observation{{
+			Query:  host,
+			Client: client,
+		}}
+	}
+	return nil
+}
+
+func clientAddress(field string) string {
+	if host, _, err := net.SplitHostPort(field); err == nil {
+		field = host
+	}
+	if net.ParseIP(field) == nil {
+		return ""
+	}
+	return field
+}
+
+func NewAccessLog(queue *models.DomainQueue, logger zerolog.Logger, logFile string) sources.Source {
+	return logtail.NewLogTail(queue, logger, "proxy access", logFile, ParseLine)
+}
@@ -0,0 +1,126 @@
+package accesslog
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+type AccessLogTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *AccessLogTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *AccessLogTestSuite) TestNewAccessLog() {
+	source := NewAccessLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.NotNil(source)
+
+	_, ok := source.(*logtail.LogTail)
+	suite.True(ok)
+}
+
+func (suite *AccessLogTestSuite) TestParseLine() {
+	testCases := []struct {
+		name     string
+		line     string
+		expected []types.Observation
+	}{
+		{
+			name:     "Squid CONNECT",
+			line:     `1286536308.779    180 192.0.2.10 TCP_TUNNEL/200 4012 CONNECT www.example.com:443 - HIER_DIRECT/203.0.113.1 -`,
+			expected: []types.Observation{{Query: "www.example.com", Client: "192.0.2.10"}},
+		},
+		{
+			name:     "Squid absolute URI",
+			line:     `1286536309.012     35 192.0.2.11 TCP_MISS/200 612 GET http://Plain.Example.org/index.html - HIER_DIRECT/203.0.113.2 text/html`,
+			expected: []types.Observation{{Query: "plain.example.org", Client: "192.0.2.11"}},
+		},
+		{
+			name:     "nginx combined forward proxy",
+			line:     `192.0.2.12 - - [10/Oct/2024:13:55:36 +0000] "GET http://api.example.net:8080/v1 HTTP/1.1" 200 612 "-" "curl/8.5.0"`,
+			expected: []types.Observation{{Query: "api.example.net", Client: "192.0.2.12"}},
+		},
+		{
+			name: "HAProxy CONNECT",
+			line: `Feb  6 12:14:14 localhost haproxy[14389]: [2001:db8::5]:33317 [06/Feb/2009:12:14:14.655] proxy-in proxy/srv1 ` +
+				`10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 "CONNECT chat.example.com:443 HTTP/1.1"`,
+			expected: []types.Observation{{Query: "chat.example.com", Client: "2001:db8::5"}},
+		},
+		{
+			name:     "Origin form request",
+			line:     `192.0.2.12 - - [10/Oct/2024:13:55:36 +0000] "GET /index.html HTTP/1.1" 200 612 "-" "curl/8.5.0"`,
+			expected: nil,
+		},
+		{
+			name:     "CONNECT to an IP literal",
+			line:     `1286536308.779    180 192.0.2.10 TCP_TUNNEL/200 4012 CONNECT [2001:db8::80]:443 - HIER_DIRECT/2001:db8::80 -`,
+			expected: nil,
+		},
+		{
+			name:     "Garbage",
+			line:     `GET`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			suite.Equal(tc.expected, ParseLine(tc.line))
+		})
+	}
+}
+
+func (suite *AccessLogTestSuite) TestProcessAddsDomains() {
+	source := NewAccessLog(suite.queue, suite.logger, DefaultLogFile).(*logtail.LogTail)
+	source.Process(`1286536308.779    180 192.0.2.10 TCP_TUNNEL/200 4012 CONNECT www.example.com:443 - HIER_DIRECT/203.0.113.1 -`)
+	source.Process(`1286536308.779    180 192.0.2.10 TCP_TUNNEL/200 4012 CONNECT 203.0.113.7:443 - HIER_DIRECT/203.0.113.7 -`)
+	source.Process(`1286536308.779    180 192.0.2.10 TCP_MISS/200 100 GET http://intranet/ - HIER_DIRECT/10.0.0.1 -`)
+
+	suite.ElementsMatch([]string{"www.example.com"}, suite.queue.Get())
+}
+
+func (suite *AccessLogTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = NewAccessLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.True(true, "Proxy access log source implements sources.Source interface")
+}
+
+func TestAccessLogTestSuite(t *testing.T) {
+	suite.Run(t, new(AccessLogTestSuite))
+}
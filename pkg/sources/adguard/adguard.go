@@ -0,0 +1,59 @@
+package adguard
+
+import (
+	"encoding/json"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+const (
+	DefaultLogFile = "/opt/AdGuardHome/data/querylog.json"
+)
+
+type result struct {
+	IsFiltered bool `json:"IsFiltered"`
+}
+
+// entry is a single querylog.json line. Answer holds the packed DNS response.
+type entry struct {
+	QH     string `json:"QH"`
+	QT     string `json:"QT"`
+	IP     string `json:"IP"`
+	Answer []byte `json:"Answer"`
+	Result result `json:"Result"`
+}
+
+// ParseLine parses a single AdGuard Home querylog.json line.
+func ParseLine(line string) []types.Observation {
+	var item entry
+	if err := json.Unmarshal([]byte(line), &item); err != nil || item.QH == "" {
+		return nil
+	}
+	observation := types.Observation{
+		Query:  item.QH,
+		QType:  item.QT,
+		Client: item.IP,
+	}
+	// Filtered queries carry a synthesized blocking answer, not the real one
+	if len(item.Answer) > 0 && !item.Result.IsFiltered {
+		msg := &layers.DNS{}
+		if err := msg.DecodeFromBytes(item.Answer, gopacket.NilDecodeFeedback); err == nil {
+			if decoded := utils.DNSObservations(msg, item.IP); len(decoded) > 0 {
+				observation.RCode = decoded[0].RCode
+				observation.Answers = decoded[0].Answers
+			}
+		}
+	}
+	return []types.Observation{observation}
+}
+
+func NewAdGuardLog(queue *models.DomainQueue, logger zerolog.Logger, logFile string) sources.Source {
+	return logtail.NewLogTail(queue, logger, "AdGuard Home", logFile, ParseLine)
+}
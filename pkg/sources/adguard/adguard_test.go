@@ -0,0 +1,128 @@
+package adguard
+
+import (
+	"encoding/base64"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+type AdGuardTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *AdGuardTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *AdGuardTestSuite) TestNewAdGuardLog() {
+	source := NewAdGuardLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.NotNil(source)
+
+	_, ok := source.(*logtail.LogTail)
+	suite.True(ok)
+}
+
+// packedAnswer builds a base64 encoded DNS response as stored in the Answer field.
+func (suite *AdGuardTestSuite) packedAnswer(name string, cname string, ip string) string {
+	msg := &layers.DNS{
+		ID:           1,
+		QR:           true,
+		RD:           true,
+		RA:           true,
+		ResponseCode: layers.DNSResponseCodeNoErr,
+		Questions:    []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte(name), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 60, CNAME: []byte(cname)},
+			{Name: []byte(cname), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.ParseIP(ip).To4()},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	suite.NoError(msg.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}))
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func (suite *AdGuardTestSuite) TestParseLine() {
+	answer := suite.packedAnswer("www.example.com", "edge.example.net", "192.0.2.1")
+	line := `{"T":"2024-01-01T12:00:00.123456789Z","QH":"www.example.com","QT":"A","QC":"IN","CP":"",` +
+		`"Upstream":"https://dns.cloudflare.com:443/dns-query","Answer":"` + answer + `","IP":"192.168.1.10",` +
+		`"Result":{},"Elapsed":1234,"Cached":false}`
+
+	suite.Equal([]types.Observation{{
+		Query:   "www.example.com",
+		QType:   "A",
+		RCode:   "NOERROR",
+		Client:  "192.168.1.10",
+		Answers: []string{"edge.example.net", "192.0.2.1"},
+	}}, ParseLine(line))
+}
+
+func (suite *AdGuardTestSuite) TestParseLineFiltered() {
+	answer := suite.packedAnswer("ads.example.com", "blocked.example.net", "0.0.0.0")
+	line := `{"T":"2024-01-01T12:00:00Z","QH":"ads.example.com","QT":"A","QC":"IN","Answer":"` + answer + `",` +
+		`"IP":"192.168.1.10","Result":{"IsFiltered":true,"Reason":3,"Rules":[{"Text":"||ads.example.com^"}]}}`
+
+	suite.Equal([]types.Observation{{Query: "ads.example.com", QType: "A", Client: "192.168.1.10"}}, ParseLine(line))
+}
+
+func (suite *AdGuardTestSuite) TestParseLineInvalid() {
+	suite.Nil(ParseLine(`{"T":"2024-01-01T12:00:00Z","QT":"A"}`))
+	suite.Nil(ParseLine(`not json`))
+	// A broken answer must not drop the query itself
+	suite.Equal([]types.Observation{{Query: "example.com", QType: "A"}},
+		ParseLine(`{"QH":"example.com","QT":"A","Answer":"AAEC"}`))
+}
+
+func (suite *AdGuardTestSuite) TestProcessAddsDomains() {
+	source := NewAdGuardLog(suite.queue, suite.logger, DefaultLogFile).(*logtail.LogTail)
+	answer := suite.packedAnswer("www.example.com", "edge.example.net", "192.0.2.1")
+	source.Process(`{"QH":"www.example.com","QT":"A","Answer":"` + answer + `","IP":"192.168.1.10","Result":{}}`)
+
+	suite.ElementsMatch([]string{"www.example.com", "edge.example.net"}, suite.queue.Get())
+}
+
+func (suite *AdGuardTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = NewAdGuardLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.True(true, "AdGuard log source implements sources.Source interface")
+}
+
+func TestAdGuardTestSuite(t *testing.T) {
+	suite.Run(t, new(AdGuardTestSuite))
+}
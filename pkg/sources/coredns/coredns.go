@@ -0,0 +1,45 @@
+package coredns
+
+import (
+	"net"
+	"regexp"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+const (
+	DefaultLogFile = "/var/log/coredns/coredns.log"
+)
+
+// commonLogFormat matches the default log plugin format:
+//
+//	{remote}:{port} - {>id} "{type} {class} {name} {proto} {size} {>do} {>bufsize}" {rcode} {>rflags} {rsize} {duration}
+//
+// It is unanchored so that the [INFO] prefix and container runtime prefixes are skipped.
+var commonLogFormat = regexp.MustCompile(`(\S+) - \d+ "(\S+) \S+ (\S+) \S+ \d+ \S+ \d+" (\S+)`)
+
+// ParseLine parses a single line written by the CoreDNS log plugin.
+func ParseLine(line string) []types.Observation {
+	match := commonLogFormat.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	client, _, err := net.SplitHostPort(match[1])
+	if err != nil {
+		client = ""
+	}
+	return []types.Observation{{
+		Query:  match[3],
+		QType:  match[2],
+		RCode:  match[4],
+		Client: client,
+	}}
+}
+
+func NewCoreDNSLog(queue *models.DomainQueue, logger zerolog.Logger, logFile string) sources.Source {
+	return logtail.NewLogTail(queue, logger, "CoreDNS", logFile, ParseLine)
+}
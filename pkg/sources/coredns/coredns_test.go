@@ -0,0 +1,105 @@
+package coredns
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+type CoreDNSTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *CoreDNSTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *CoreDNSTestSuite) TestNewCoreDNSLog() {
+	source := NewCoreDNSLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.NotNil(source)
+
+	_, ok := source.(*logtail.LogTail)
+	suite.True(ok)
+}
+
+func (suite *CoreDNSTestSuite) TestParseLine() {
+	testCases := []struct {
+		name     string
+		line     string
+		expected []types.Observation
+	}{
+		{
+			name:     "Plain log plugin line",
+			line:     `[INFO] 172.17.0.1:58532 - 28717 "A IN example.com. udp 29 false 512" NOERROR qr,rd,ra 68 0.023457s`,
+			expected: []types.Observation{{Query: "example.com.", QType: "A", RCode: "NOERROR", Client: "172.17.0.1"}},
+		},
+		{
+			name: "Kubernetes container log with IPv6 client",
+			line: `2024-01-01T12:00:00.000000000Z stdout F [INFO] [2001:db8::1]:40000 - 1 ` +
+				`"AAAA IN api.example.org. tcp 40 true 65535" NXDOMAIN qr,aa,rd 120 0.0001s`,
+			expected: []types.Observation{{Query: "api.example.org.", QType: "AAAA", RCode: "NXDOMAIN", Client: "2001:db8::1"}},
+		},
+		{
+			name:     "Startup line",
+			line:     `[INFO] plugin/reload: Running configuration SHA512 = 1234`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			suite.Equal(tc.expected, ParseLine(tc.line))
+		})
+	}
+}
+
+func (suite *CoreDNSTestSuite) TestProcessAddsDomains() {
+	source := NewCoreDNSLog(suite.queue, suite.logger, DefaultLogFile).(*logtail.LogTail)
+	source.Process(`[INFO] 10.0.0.5:1000 - 1 "A IN www.example.com. udp 33 false 512" NOERROR qr,rd,ra 80 0.01s`)
+	source.Process(`[INFO] 10.0.0.5:1000 - 2 "A IN kube-dns.kube-system.svc.cluster.local. udp 56 false 512" NOERROR qr,aa,rd 110 0.0001s`)
+
+	suite.ElementsMatch([]string{"www.example.com"}, suite.queue.Get())
+}
+
+func (suite *CoreDNSTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = NewCoreDNSLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.True(true, "CoreDNS log source implements sources.Source interface")
+}
+
+func TestCoreDNSTestSuite(t *testing.T) {
+	suite.Run(t, new(CoreDNSTestSuite))
+}
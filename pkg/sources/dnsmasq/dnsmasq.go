@@ -0,0 +1,73 @@
+package dnsmasq
+
+import (
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+const (
+	// DefaultLogFile is where Pi-hole keeps the dnsmasq/FTL query log.
+	DefaultLogFile = "/var/log/pihole/pihole.log"
+)
+
+// ParseLine parses dnsmasq log-queries output, e.g.:
+//
+//	dnsmasq[1234]: query[A] example.com from 192.168.1.10
+//	dnsmasq[1234]: forwarded example.com to 8.8.8.8
+//	dnsmasq[1234]: reply example.com is 93.184.216.34
+//	dnsmasq[1234]: cached example.com is NXDOMAIN
+//
+// Pi-hole "gravity blocked", "exactly blocked" and similar lines are treated like replies.
+func ParseLine(line string) []types.Observation {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		if i+1 >= len(fields) {
+			break
+		}
+		name := fields[i+1]
+		switch {
+		case strings.HasPrefix(field, "query[") && strings.HasSuffix(field, "]"):
+			observation := types.Observation{
+				Query: name,
+				QType: strings.TrimSuffix(strings.TrimPrefix(field, "query["), "]"),
+			}
+			if i+3 < len(fields) && fields[i+2] == "from" {
+				observation.Client = fields[i+3]
+			}
+			return []types.Observation{observation}
+		case field == "forwarded":
+			return []types.Observation{{Query: name}}
+		case field == "reply" || field == "cached" || field == "blocked":
+			return []types.Observation{parseReply(name, fields[i+2:])}
+		}
+	}
+	return nil
+}
+
+// parseReply handles the "<name> is <answer>" tail of reply style lines.
+func parseReply(name string, rest []string) types.Observation {
+	observation := types.Observation{Query: name}
+	if len(rest) < 2 || rest[0] != "is" {
+		return observation
+	}
+	answer := rest[1]
+	switch {
+	case net.ParseIP(answer) != nil:
+		observation.Answers = []string{answer}
+	case answer == "NXDOMAIN" || answer == "NODATA":
+		observation.RCode = answer
+	case strings.HasPrefix(answer, "NODATA-"):
+		observation.RCode = "NODATA"
+	}
+	return observation
+}
+
+func NewDnsmasqLog(queue *models.DomainQueue, logger zerolog.Logger, logFile string) sources.Source {
+	return logtail.NewLogTail(queue, logger, "dnsmasq", logFile, ParseLine)
+}
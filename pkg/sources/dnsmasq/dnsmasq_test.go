@@ -0,0 +1,142 @@
+package dnsmasq
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+type DnsmasqTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *DnsmasqTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *DnsmasqTestSuite) TestNewDnsmasqLog() {
+	source := NewDnsmasqLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.NotNil(source)
+
+	_, ok := source.(*logtail.LogTail)
+	suite.True(ok)
+}
+
+func (suite *DnsmasqTestSuite) TestParseLine() {
+	testCases := []struct {
+		name     string
+		line     string
+		expected []types.Observation
+	}{
+		{
+			name:     "Query",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: query[A] example.com from 192.168.1.10",
+			expected: []types.Observation{{Query: "example.com", QType: "A", Client: "192.168.1.10"}},
+		},
+		{
+			name:     "Query with log-queries=extra",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: 7 192.168.1.10/40000 query[AAAA] example.org from 192.168.1.10",
+			expected: []types.Observation{{Query: "example.org", QType: "AAAA", Client: "192.168.1.10"}},
+		},
+		{
+			name:     "Forwarded",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: forwarded example.com to 8.8.8.8",
+			expected: []types.Observation{{Query: "example.com"}},
+		},
+		{
+			name:     "Reply with address",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: reply example.com is 93.184.216.34",
+			expected: []types.Observation{{Query: "example.com", Answers: []string{"93.184.216.34"}}},
+		},
+		{
+			name:     "Reply with CNAME",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: reply www.example.com is <CNAME>",
+			expected: []types.Observation{{Query: "www.example.com"}},
+		},
+		{
+			name:     "Cached NXDOMAIN",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: cached nope.example.com is NXDOMAIN",
+			expected: []types.Observation{{Query: "nope.example.com", RCode: "NXDOMAIN"}},
+		},
+		{
+			name:     "Pi-hole gravity blocked",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: gravity blocked ads.example.com is 0.0.0.0",
+			expected: []types.Observation{{Query: "ads.example.com", Answers: []string{"0.0.0.0"}}},
+		},
+		{
+			name:     "Unrelated line",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: started, version 2.89 cachesize 10000",
+			expected: nil,
+		},
+		{
+			name:     "Truncated line",
+			line:     "Jan  1 12:00:00 dnsmasq[1234]: reply",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			suite.Equal(tc.expected, ParseLine(tc.line))
+		})
+	}
+}
+
+func (suite *DnsmasqTestSuite) TestProcessAddsDomains() {
+	source := NewDnsmasqLog(suite.queue, suite.logger, DefaultLogFile).(*logtail.LogTail)
+	lines := []string{
+		"Jan  1 12:00:00 dnsmasq[1234]: query[A] test1.com from 192.168.1.10",
+		"Jan  1 12:00:00 dnsmasq[1234]: forwarded test1.com to 8.8.8.8",
+		"Jan  1 12:00:00 dnsmasq[1234]: reply test1.com is 1.2.3.4",
+		"Jan  1 12:00:00 dnsmasq[1234]: cached test2.org is 5.6.7.8",
+		"Jan  1 12:00:00 dnsmasq[1234]: query[A] printer.local from 192.168.1.10",
+	}
+	for _, line := range lines {
+		source.Process(line)
+	}
+
+	suite.ElementsMatch([]string{"test1.com", "test2.org"}, suite.queue.Get())
+}
+
+func (suite *DnsmasqTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = NewDnsmasqLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.True(true, "dnsmasq log source implements sources.Source interface")
+}
+
+func TestDnsmasqTestSuite(t *testing.T) {
+	suite.Run(t, new(DnsmasqTestSuite))
+}
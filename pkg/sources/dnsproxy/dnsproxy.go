@@ -0,0 +1,134 @@
+package dnsproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+)
+
+const (
+	DefaultListenAddr = "127.0.0.1:5300"
+)
+
+// DNSProxy is a forwarding resolver that records every query and response passing through it.
+type DNSProxy struct {
+	queue      *models.DomainQueue
+	logger     zerolog.Logger
+	listenAddr string
+	forwarder  *Forwarder
+	servers    []*dns.Server
+	addr       string
+	lock       sync.Mutex
+}
+
+func (p *DNSProxy) Start() error {
+	p.logger.Info().Msgf("Starting DNS proxy source on %s...", p.listenAddr)
+	packetConn, err := net.ListenPacket("udp", p.listenAddr)
+	if err != nil {
+		return fmt.Errorf("error listening on udp %s: %w", p.listenAddr, err)
+	}
+	// Bind TCP to the port UDP actually got, so that ":0" works for both
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		_ = packetConn.Close()
+		return fmt.Errorf("error listening on tcp %s: %w", packetConn.LocalAddr(), err)
+	}
+
+	p.lock.Lock()
+	p.addr = packetConn.LocalAddr().String()
+	p.servers = []*dns.Server{
+		{PacketConn: packetConn, Handler: p},
+		{Listener: listener, Handler: p},
+	}
+	servers := p.servers
+	p.lock.Unlock()
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			errs <- server.ActivateAndServe()
+		}(server)
+	}
+	var result error
+	for range servers {
+		if err := <-errs; err != nil {
+			result = errors.Join(result, err)
+		}
+	}
+	return result
+}
+
+func (p *DNSProxy) Stop(ctx context.Context) error {
+	p.logger.Info().Msg("Stopping DNS proxy source...")
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var result error
+	for _, server := range p.servers {
+		if err := server.ShutdownContext(ctx); err != nil {
+			result = errors.Join(result, err)
+		}
+	}
+	p.servers = nil
+	return result
+}
+
+// Addr returns the address the proxy is bound to, or "" if it hasn't started yet.
+func (p *DNSProxy) Addr() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.addr
+}
+
+func (p *DNSProxy) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	client, _, err := net.SplitHostPort(w.RemoteAddr().String())
+	if err != nil {
+		client = w.RemoteAddr().String()
+	}
+	p.record(r, client)
+
+	network := "udp"
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		network = "tcp"
+	}
+	response, err := p.forwarder.Exchange(context.Background(), r, network)
+	if err != nil {
+		p.logger.Debug().Err(err).Msg("Error forwarding DNS query")
+		response = new(dns.Msg)
+		response.SetRcode(r, dns.RcodeServerFailure)
+	} else {
+		p.record(response, client)
+	}
+	if network == "udp" {
+		// The upstream answer may have come over TCP, or be larger than the client's buffer
+		size := dns.MinMsgSize
+		if opt := r.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		response.Truncate(size)
+	}
+	if err := w.WriteMsg(response); err != nil {
+		p.logger.Debug().Err(err).Msg("Error writing DNS response")
+	}
+}
+
+func (p *DNSProxy) record(msg *dns.Msg, client string) {
+	for _, observation := range Observations(msg, client) {
+		p.queue.AddObservation(observation)
+	}
+}
+
+func NewDNSProxy(queue *models.DomainQueue, logger zerolog.Logger, listenAddr string, forwarder *Forwarder) sources.Source {
+	return &DNSProxy{
+		queue:      queue,
+		logger:     logger,
+		listenAddr: listenAddr,
+		forwarder:  forwarder,
+	}
+}
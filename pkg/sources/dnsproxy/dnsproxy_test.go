@@ -0,0 +1,227 @@
+package dnsproxy
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+// upstreamHandler answers every query with a CNAME to edge.example.net and an A record,
+// except large.example.com, which gets more A records than fit in 512 bytes.
+func upstreamHandler(w dns.ResponseWriter, r *dns.Msg) {
+	response := new(dns.Msg)
+	response.SetReply(r)
+	name := r.Question[0].Name
+	if name == "large.example.com." {
+		for i := 1; i <= 64; i++ {
+			response.Answer = append(response.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(192, 0, 2, byte(i)),
+			})
+		}
+		if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+			response.Truncate(dns.MinMsgSize)
+		}
+		_ = w.WriteMsg(response)
+		return
+	}
+	response.Answer = []dns.RR{
+		&dns.CNAME{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60}, Target: "edge.example.net."},
+		&dns.A{Hdr: dns.RR_Header{Name: "edge.example.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP("192.0.2.1")},
+	}
+	_ = w.WriteMsg(response)
+}
+
+type DNSProxyTestSuite struct {
+	suite.Suite
+	queue     *models.DomainQueue
+	logger    zerolog.Logger
+	upstreams []*dns.Server
+	forwarder *Forwarder
+	proxy     *DNSProxy
+	done      chan error
+}
+
+func (suite *DNSProxyTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+
+	// Serve the upstream on the same port over UDP and TCP
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	suite.Require().NoError(err)
+	suite.upstreams = []*dns.Server{
+		{PacketConn: packetConn, Handler: dns.HandlerFunc(upstreamHandler)},
+		{Listener: listener, Handler: dns.HandlerFunc(upstreamHandler)},
+	}
+	for _, server := range suite.upstreams {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go func(server *dns.Server) {
+			_ = server.ActivateAndServe()
+		}(server)
+		<-started
+	}
+	suite.forwarder = NewForwarder([]string{packetConn.LocalAddr().String()}, time.Second)
+}
+
+func (suite *DNSProxyTestSuite) TearDownTest() {
+	if suite.proxy != nil {
+		_ = suite.proxy.Stop(context.Background())
+		<-suite.done
+		suite.proxy = nil
+	}
+	for _, server := range suite.upstreams {
+		_ = server.Shutdown()
+	}
+}
+
+func (suite *DNSProxyTestSuite) startProxy(forwarder *Forwarder) {
+	suite.proxy = NewDNSProxy(suite.queue, suite.logger, "127.0.0.1:0", forwarder).(*DNSProxy)
+	suite.done = make(chan error, 1)
+	go func() {
+		suite.done <- suite.proxy.Start()
+	}()
+	suite.Require().Eventually(func() bool {
+		return suite.proxy.Addr() != ""
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (suite *DNSProxyTestSuite) exchange(network, name string) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeA)
+	return suite.exchangeMsg(network, msg)
+}
+
+func (suite *DNSProxyTestSuite) exchangeMsg(network string, msg *dns.Msg) *dns.Msg {
+	client := &dns.Client{Net: network, Timeout: 2 * time.Second}
+	var (
+		response *dns.Msg
+		err      error
+	)
+	// The listeners may need a moment to be served after Addr() is set
+	suite.Require().Eventually(func() bool {
+		response, _, err = client.Exchange(msg, suite.proxy.Addr())
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	return response
+}
+
+func (suite *DNSProxyTestSuite) TestForwardsAndRecordsUDP() {
+	suite.startProxy(suite.forwarder)
+	response := suite.exchange("udp", "www.example.com.")
+	suite.Equal(dns.RcodeSuccess, response.Rcode)
+	suite.Len(response.Answer, 2)
+
+	suite.ElementsMatch([]string{"www.example.com", "edge.example.net"}, suite.queue.Get())
+}
+
+func (suite *DNSProxyTestSuite) TestForwardsAndRecordsTCP() {
+	suite.startProxy(suite.forwarder)
+	response := suite.exchange("tcp", "api.example.org.")
+	suite.Equal(dns.RcodeSuccess, response.Rcode)
+
+	suite.ElementsMatch([]string{"api.example.org", "edge.example.net"}, suite.queue.Get())
+}
+
+func (suite *DNSProxyTestSuite) TestTruncatesUDP() {
+	suite.startProxy(suite.forwarder)
+	// The forwarder retries the truncated upstream answer over TCP, the proxy truncates it again
+	response := suite.exchange("udp", "large.example.com.")
+	suite.True(response.Truncated)
+	suite.Less(len(response.Answer), 64)
+	response.Compress = true
+	packed, err := response.Pack()
+	suite.Require().NoError(err)
+	suite.LessOrEqual(len(packed), dns.MinMsgSize)
+
+	// Up to the buffer size the client advertises with EDNS
+	msg := new(dns.Msg)
+	msg.SetQuestion("large.example.com.", dns.TypeA)
+	msg.SetEdns0(4096, false)
+	response = suite.exchangeMsg("udp", msg)
+	suite.False(response.Truncated)
+	suite.Len(response.Answer, 64)
+
+	suite.Len(suite.exchange("tcp", "large.example.com.").Answer, 64)
+}
+
+func (suite *DNSProxyTestSuite) TestUpstreamFailure() {
+	suite.startProxy(NewForwarder(nil, time.Second))
+	response := suite.exchange("udp", "www.example.com.")
+	suite.Equal(dns.RcodeServerFailure, response.Rcode)
+
+	// The query is still recorded even though nobody could answer it
+	suite.ElementsMatch([]string{"www.example.com"}, suite.queue.Get())
+}
+
+func (suite *DNSProxyTestSuite) TestNewForwarder() {
+	forwarder := NewForwarder([]string{"192.0.2.53", " [2001:db8::53] ", "192.0.2.54:5353", ""}, 0)
+	suite.Equal([]string{"192.0.2.53:53", "[2001:db8::53]:53", "192.0.2.54:5353"}, forwarder.upstreams)
+	suite.Equal(DefaultUpstreamTimeout, forwarder.timeout)
+}
+
+func (suite *DNSProxyTestSuite) TestObservations() {
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.com.", dns.TypeAAAA)
+	suite.Equal([]types.Observation{{Query: "www.example.com", QType: "AAAA", Client: "192.168.1.10"}},
+		Observations(query, "192.168.1.10"))
+
+	response := new(dns.Msg)
+	response.SetRcode(query, dns.RcodeNameError)
+	suite.Equal([]types.Observation{{Query: "www.example.com", QType: "AAAA", RCode: "NXDOMAIN", Client: "192.168.1.10"}},
+		Observations(response, "192.168.1.10"))
+
+	response.SetRcode(query, dns.RcodeSuccess)
+	response.Answer = []dns.RR{
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60}, Target: "edge.example.net."},
+		&dns.AAAA{Hdr: dns.RR_Header{Name: "edge.example.net.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60}, AAAA: net.ParseIP("2001:db8::1")},
+	}
+	suite.Equal([]types.Observation{{Query: "www.example.com", QType: "AAAA", RCode: "NOERROR", Client: "192.168.1.10",
+		Answers: []string{"edge.example.net", "2001:db8::1"}}},
+		Observations(response, "192.168.1.10"))
+}
+
+func (suite *DNSProxyTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = &DNSProxy{}
+	suite.True(true, "DNSProxy implements sources.Source interface")
+}
+
+func TestDNSProxyTestSuite(t *testing.T) {
+	suite.Run(t, new(DNSProxyTestSuite))
+}
@@ -0,0 +1,85 @@
+package dnsproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/miekg/dns"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+const (
+	DefaultUpstreamTimeout = 5 * time.Second
+)
+
+// Forwarder sends queries to a list of upstream resolvers, trying them in order.
+type Forwarder struct {
+	upstreams []string
+	timeout   time.Duration
+}
+
+// Exchange forwards msg over network ("udp" or "tcp") and returns the first upstream answer.
+// A truncated UDP answer is retried over TCP against the same upstream.
+func (f *Forwarder) Exchange(ctx context.Context, msg *dns.Msg, network string) (*dns.Msg, error) {
+	if len(f.upstreams) == 0 {
+		return nil, errors.New("no upstream resolvers configured")
+	}
+	var lastErr error
+	for _, upstream := range f.upstreams {
+		client := &dns.Client{Net: network, Timeout: f.timeout}
+		response, _, err := client.ExchangeContext(ctx, msg, upstream)
+		if err == nil && response.Truncated && network == "udp" {
+			client.Net = "tcp"
+			response, _, err = client.ExchangeContext(ctx, msg, upstream)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("upstream %s: %w", upstream, err)
+			continue
+		}
+		return response, nil
+	}
+	return nil, lastErr
+}
+
+// NewForwarder creates a forwarder, upstreams without a port default to 53.
+func NewForwarder(upstreams []string, timeout time.Duration) *Forwarder {
+	normalized := make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		upstream = strings.TrimSpace(upstream)
+		if upstream == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(upstream); err != nil {
+			upstream = net.JoinHostPort(strings.Trim(upstream, "[]"), "53")
+		}
+		normalized = append(normalized, upstream)
+	}
+	if timeout <= 0 {
+		timeout = DefaultUpstreamTimeout
+	}
+	return &Forwarder{
+		upstreams: normalized,
+		timeout:   timeout,
+	}
+}
+
+// Observations converts a DNS message into one observation per question, decoding it the way
+// packet capture does, see utils.DNSObservations. Messages that don't pack yield none.
+func Observations(msg *dns.Msg, client string) []types.Observation {
+	wire, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	decoded := new(layers.DNS)
+	if err := decoded.DecodeFromBytes(wire, gopacket.NilDecodeFeedback); err != nil {
+		return nil
+	}
+	return utils.DNSObservations(decoded, client)
+}
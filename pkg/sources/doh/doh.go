@@ -0,0 +1,192 @@
+package doh
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/dnsproxy"
+)
+
+const (
+	DefaultListenAddr = "127.0.0.1:8053"
+	DefaultPath       = "/dns-query"
+	ContentType       = "application/dns-message"
+	// MaxMessageSize is the largest DNS message we accept, see RFC 8484 section 6.
+	MaxMessageSize = 65535
+)
+
+// DoH is an RFC 8484 DNS-over-HTTPS endpoint that forwards queries to plain DNS upstreams.
+type DoH struct {
+	queue      *models.DomainQueue
+	logger     zerolog.Logger
+	listenAddr string
+	path       string
+	certFile   string
+	keyFile    string
+	forwarder  *dnsproxy.Forwarder
+	server     *http.Server
+	addr       string
+	lock       sync.Mutex
+}
+
+func (d *DoH) Start() error {
+	d.logger.Info().Msgf("Starting DoH source on %s%s...", d.listenAddr, d.path)
+	if (d.certFile == "") != (d.keyFile == "") {
+		return errors.New("DoH needs both a TLS certificate and key, or neither for plain HTTP")
+	}
+	listener, err := net.Listen("tcp", d.listenAddr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", d.listenAddr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(d.path, d)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	d.lock.Lock()
+	d.server = server
+	d.addr = listener.Addr().String()
+	d.lock.Unlock()
+
+	// Without a certificate we serve plain HTTP, e.g. behind a TLS terminating reverse proxy
+	if d.certFile != "" {
+		err = server.ServeTLS(listener, d.certFile, d.keyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (d *DoH) Stop(ctx context.Context) error {
+	d.logger.Info().Msg("Stopping DoH source...")
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.server == nil {
+		return nil
+	}
+	return d.server.Shutdown(ctx)
+}
+
+// Addr returns the address the endpoint is bound to, or "" if it hasn't started yet.
+func (d *DoH) Addr() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.addr
+}
+
+func (d *DoH) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		wire []byte
+		err  error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		wire, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil || len(wire) == 0 {
+			http.Error(w, "missing or malformed dns parameter", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != ContentType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		wire, err = io.ReadAll(io.LimitReader(r.Body, MaxMessageSize+1))
+		if err != nil || len(wire) == 0 || len(wire) > MaxMessageSize {
+			http.Error(w, "missing or malformed dns message", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil {
+		http.Error(w, "malformed dns message", http.StatusBadRequest)
+		return
+	}
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	d.record(msg, client)
+
+	response, err := d.forwarder.Exchange(r.Context(), msg, "udp")
+	if err != nil {
+		d.logger.Debug().Err(err).Msg("Error forwarding DoH query")
+		response = new(dns.Msg)
+		response.SetRcode(msg, dns.RcodeServerFailure)
+	} else {
+		d.record(response, client)
+	}
+	packed, err := response.Pack()
+	if err != nil {
+		http.Error(w, "error packing dns response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(minTTL(response)), 10))
+	if _, err := w.Write(packed); err != nil {
+		d.logger.Debug().Err(err).Msg("Error writing DoH response")
+	}
+}
+
+func (d *DoH) record(msg *dns.Msg, client string) {
+	for _, observation := range dnsproxy.Observations(msg, client) {
+		d.queue.AddObservation(observation)
+	}
+}
+
+// minTTL is the smallest TTL in the answer, used for HTTP caching as RFC 8484 section 5.1 suggests.
+// Negative answers are cached as long as RFC 2308 section 5 allows, by the SOA in the authority section.
+func minTTL(msg *dns.Msg) uint32 {
+	var ttl uint32
+	for i, rr := range msg.Answer {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	if len(msg.Answer) > 0 {
+		return ttl
+	}
+	for _, rr := range msg.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return min(soa.Hdr.Ttl, soa.Minttl)
+		}
+	}
+	return 0
+}
+
+func NewDoH(queue *models.DomainQueue, logger zerolog.Logger, listenAddr, path, certFile, keyFile string,
+	forwarder *dnsproxy.Forwarder) sources.Source {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &DoH{
+		queue:      queue,
+		logger:     logger,
+		listenAddr: listenAddr,
+		path:       path,
+		certFile:   certFile,
+		keyFile:    keyFile,
+		forwarder:  forwarder,
+	}
+}
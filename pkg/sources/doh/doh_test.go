@@ -0,0 +1,214 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/dnsproxy"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+func upstreamHandler(w dns.ResponseWriter, r *dns.Msg) {
+	response := new(dns.Msg)
+	response.SetReply(r)
+	if r.Question[0].Name == "missing.example.com." {
+		response.Rcode = dns.RcodeNameError
+		response.Ns = []dns.RR{
+			&dns.SOA{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+				Ns: "ns.example.com.", Mbox: "hostmaster.example.com.", Serial: 1, Refresh: 7200, Retry: 900, Expire: 86400, Minttl: 120},
+		}
+		_ = w.WriteMsg(response)
+		return
+	}
+	response.Answer = []dns.RR{
+		&dns.CNAME{Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: "edge.example.net."},
+		&dns.A{Hdr: dns.RR_Header{Name: "edge.example.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP("192.0.2.1")},
+	}
+	_ = w.WriteMsg(response)
+}
+
+type DoHTestSuite struct {
+	suite.Suite
+	queue    *models.DomainQueue
+	logger   zerolog.Logger
+	upstream *dns.Server
+	doh      *DoH
+	server   *httptest.Server
+}
+
+func (suite *DoHTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	started := make(chan struct{})
+	suite.upstream = &dns.Server{PacketConn: packetConn, Handler: dns.HandlerFunc(upstreamHandler), NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = suite.upstream.ActivateAndServe()
+	}()
+	<-started
+
+	forwarder := dnsproxy.NewForwarder([]string{packetConn.LocalAddr().String()}, time.Second)
+	suite.doh = NewDoH(suite.queue, suite.logger, "127.0.0.1:0", DefaultPath, "", "", forwarder).(*DoH)
+	suite.server = httptest.NewServer(suite.doh)
+}
+
+func (suite *DoHTestSuite) TearDownTest() {
+	suite.server.Close()
+	_ = suite.upstream.Shutdown()
+}
+
+func (suite *DoHTestSuite) packedQuery(name string) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeA)
+	// RFC 8484 recommends ID 0 for cache friendliness
+	msg.Id = 0
+	packed, err := msg.Pack()
+	suite.Require().NoError(err)
+	return packed
+}
+
+func (suite *DoHTestSuite) unpack(resp *http.Response) *dns.Msg {
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal(ContentType, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	suite.Require().NoError(err)
+	msg := new(dns.Msg)
+	suite.Require().NoError(msg.Unpack(body))
+	return msg
+}
+
+func (suite *DoHTestSuite) TestGet() {
+	query := base64.RawURLEncoding.EncodeToString(suite.packedQuery("www.example.com."))
+	resp, err := http.Get(suite.server.URL + DefaultPath + "?dns=" + query)
+	suite.Require().NoError(err)
+	suite.Equal("max-age=60", resp.Header.Get("Cache-Control"))
+
+	msg := suite.unpack(resp)
+	suite.Equal(dns.RcodeSuccess, msg.Rcode)
+	suite.Len(msg.Answer, 2)
+	suite.ElementsMatch([]string{"www.example.com", "edge.example.net"}, suite.queue.Get())
+}
+
+func (suite *DoHTestSuite) TestNegativeCaching() {
+	query := base64.RawURLEncoding.EncodeToString(suite.packedQuery("missing.example.com."))
+	resp, err := http.Get(suite.server.URL + DefaultPath + "?dns=" + query)
+	suite.Require().NoError(err)
+	suite.Equal("max-age=120", resp.Header.Get("Cache-Control"))
+	suite.Equal(dns.RcodeNameError, suite.unpack(resp).Rcode)
+}
+
+func (suite *DoHTestSuite) TestPost() {
+	resp, err := http.Post(suite.server.URL+DefaultPath, ContentType, bytes.NewReader(suite.packedQuery("api.example.org.")))
+	suite.Require().NoError(err)
+
+	msg := suite.unpack(resp)
+	suite.Equal(dns.RcodeSuccess, msg.Rcode)
+	suite.ElementsMatch([]string{"api.example.org", "edge.example.net"}, suite.queue.Get())
+}
+
+func (suite *DoHTestSuite) TestBadRequests() {
+	testCases := []struct {
+		name   string
+		method string
+		query  string
+		ctype  string
+		body   []byte
+		status int
+	}{
+		{name: "GET without dns", method: http.MethodGet, status: http.StatusBadRequest},
+		{name: "GET with bad base64", method: http.MethodGet, query: "?dns=!!!", status: http.StatusBadRequest},
+		{name: "GET with garbage message", method: http.MethodGet, query: "?dns=AAEC", status: http.StatusBadRequest},
+		{name: "POST with wrong content type", method: http.MethodPost, ctype: "text/plain", body: []byte("x"), status: http.StatusUnsupportedMediaType},
+		{name: "POST without body", method: http.MethodPost, ctype: ContentType, status: http.StatusBadRequest},
+		{name: "PUT", method: http.MethodPut, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			req, err := http.NewRequest(tc.method, suite.server.URL+DefaultPath+tc.query, bytes.NewReader(tc.body))
+			suite.Require().NoError(err)
+			if tc.ctype != "" {
+				req.Header.Set("Content-Type", tc.ctype)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			suite.Require().NoError(err)
+			resp.Body.Close()
+			suite.Equal(tc.status, resp.StatusCode)
+		})
+	}
+	suite.Equal(0, suite.queue.Count())
+}
+
+func (suite *DoHTestSuite) TestStartStop() {
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.doh.Start()
+	}()
+	suite.Require().Eventually(func() bool {
+		return suite.doh.Addr() != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, err := http.Post("http://"+suite.doh.Addr()+DefaultPath, ContentType, bytes.NewReader(suite.packedQuery("www.example.com.")))
+	suite.Require().NoError(err)
+	suite.unpack(resp)
+
+	suite.NoError(suite.doh.Stop(context.Background()))
+	suite.NoError(<-done)
+}
+
+func (suite *DoHTestSuite) TestCertWithoutKey() {
+	forwarder := dnsproxy.NewForwarder([]string{"127.0.0.1:53"}, time.Second)
+	for _, files := range [][2]string{{"doh.pem", ""}, {"", "doh.key"}} {
+		doh := NewDoH(suite.queue, suite.logger, "127.0.0.1:0", DefaultPath, files[0], files[1], forwarder)
+		suite.ErrorContains(doh.Start(), "both a TLS certificate and key")
+	}
+}
+
+func (suite *DoHTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = &DoH{}
+	suite.True(true, "DoH implements sources.Source interface")
+}
+
+func TestDoHTestSuite(t *testing.T) {
+	suite.Run(t, new(DoHTestSuite))
+}
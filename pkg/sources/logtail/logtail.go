@@ -0,0 +1,77 @@
+package logtail
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/hpcloud/tail"
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+// ParseFunc extracts DNS observations from a single log line.
+type ParseFunc func(line string) []types.Observation
+
+// LogTail follows a log file and feeds every name found by its parser into the queue.
+// It is shared by all log based sources, which only differ in their ParseFunc.
+type LogTail struct {
+	queue   *models.DomainQueue
+	logger  zerolog.Logger
+	name    string
+	logFile string
+	parse   ParseFunc
+	tail    *tail.Tail
+	lock    sync.Mutex
+}
+
+func (l *LogTail) Start() error {
+	l.logger.Info().Msgf("Starting %s log source...", l.name)
+	t, err := tail.TailFile(l.logFile, tail.Config{Follow: true, ReOpen: true})
+	if err != nil {
+		l.logger.Error().Err(err).Msgf("Error opening log file: %s", l.logFile)
+		return err
+	}
+	l.lock.Lock()
+	l.tail = t
+	l.lock.Unlock()
+
+	for lineItem := range t.Lines {
+		l.Process(lineItem.Text)
+	}
+
+	return nil
+}
+
+func (l *LogTail) Stop(ctx context.Context) error {
+	l.logger.Info().Msgf("Stopping %s log source...", l.name)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.tail == nil {
+		return nil
+	}
+	defer l.tail.Cleanup()
+	return l.tail.Stop()
+}
+
+// Process parses a single log line and adds every name to the queue.
+func (l *LogTail) Process(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	for _, observation := range l.parse(line) {
+		l.queue.AddObservation(observation)
+	}
+}
+
+func NewLogTail(queue *models.DomainQueue, logger zerolog.Logger, name, logFile string, parse ParseFunc) *LogTail {
+	return &LogTail{
+		queue:   queue,
+		logger:  logger,
+		name:    name,
+		logFile: logFile,
+		parse:   parse,
+	}
+}
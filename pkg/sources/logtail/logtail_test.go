@@ -0,0 +1,128 @@
+package logtail
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+// parseFields treats every field of the line as a query name.
+func parseFields(line string) []types.Observation {
+	var observations []types.Observation
+	for _, field := range strings.Fields(line) {
+		observations = append(observations, types.Observation{Query: field})
+	}
+	return observations
+}
+
+type LogTailTestSuite struct {
+	suite.Suite
+	logTail  *LogTail
+	queue    *models.DomainQueue
+	logger   zerolog.Logger
+	tempFile *os.File
+}
+
+func (suite *LogTailTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+
+	tempFile, err := os.CreateTemp("", "logtail_test_*.log")
+	suite.NoError(err)
+	suite.tempFile = tempFile
+
+	suite.logTail = NewLogTail(suite.queue, suite.logger, "test", tempFile.Name(), parseFields)
+}
+
+func (suite *LogTailTestSuite) TearDownTest() {
+	if suite.tempFile != nil {
+		suite.tempFile.Close()
+		os.Remove(suite.tempFile.Name())
+	}
+}
+
+func (suite *LogTailTestSuite) TestProcess() {
+	suite.logTail.Process("  example.com. test.local single 10.0.0.1 www.example.org  ")
+	suite.logTail.Process("")
+
+	suite.ElementsMatch([]string{"example.com", "www.example.org"}, suite.queue.Get())
+}
+
+func (suite *LogTailTestSuite) TestProcessAnswers() {
+	logTail := NewLogTail(suite.queue, suite.logger, "test", suite.tempFile.Name(), func(line string) []types.Observation {
+		return []types.Observation{{Query: line, Answers: []string{"cdn.example.net.", "192.0.2.1", "2001:db8::1"}}}
+	})
+	logTail.Process("www.example.com")
+
+	suite.ElementsMatch([]string{"www.example.com", "cdn.example.net"}, suite.queue.Get())
+}
+
+func (suite *LogTailTestSuite) TestStopBeforeStart() {
+	suite.NoError(suite.logTail.Stop(context.Background()))
+}
+
+func (suite *LogTailTestSuite) TestStartFollowsFile() {
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.logTail.Start()
+	}()
+
+	_, err := suite.tempFile.WriteString("first.example.com\nsecond.example.com\n")
+	suite.NoError(err)
+	suite.NoError(suite.tempFile.Sync())
+
+	suite.Eventually(func() bool {
+		return suite.queue.Count() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	suite.NoError(suite.logTail.Stop(context.Background()))
+	select {
+	case err := <-done:
+		suite.NoError(err)
+	case <-time.After(5 * time.Second):
+		suite.Fail("Start did not return after Stop")
+	}
+	suite.ElementsMatch([]string{"first.example.com", "second.example.com"}, suite.queue.Get())
+}
+
+func (suite *LogTailTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = &LogTail{}
+	suite.True(true, "LogTail implements sources.Source interface")
+}
+
+func TestLogTailTestSuite(t *testing.T) {
+	suite.Run(t, new(LogTailTestSuite))
+}
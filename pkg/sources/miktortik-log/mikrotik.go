@@ -8,7 +8,6 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/tb0hdan/pdns-sensor/pkg/models"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources"
-	"github.com/tb0hdan/pdns-sensor/pkg/utils"
 )
 
 const (
@@ -42,11 +41,7 @@ func (m *MikrotikLog) Start() error {
 			if !strings.HasSuffix(field, ".") {
 				continue
 			}
-			field = strings.TrimSuffix(field, ".")
-			if !utils.IsValidDomain(field) {
-				continue
-			}
-			m.queue.Add(field)
+			m.queue.Add(strings.TrimSuffix(field, "."))
 		}
 
 	}
@@ -0,0 +1,176 @@
+package packet
+
+import (
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+)
+
+const (
+	HTTPSPort = 443
+)
+
+// Options selects what the decoder looks at besides DNS.
+type Options struct {
+	// SNI enables hostname extraction from TLS ClientHello and QUIC Initial packets to port 443.
+	SNI bool
+	// HTTP enables hostname extraction from plaintext HTTP/1.x requests.
+	HTTP bool
+	// Local enables mDNS, LLMNR and NetBIOS-NS. Names that can't be submitted are counted instead.
+	Local bool
+	// Ports are extra DNS ports, e.g. 5053 for dnscrypt-proxy, decoded over both UDP and TCP.
+	Ports []uint16
+}
+
+// Decoder extracts host names from captured packets and adds them to the queue.
+// It is shared by every source that gets packets, no matter how they were captured.
+type Decoder struct {
+	queue   *models.DomainQueue
+	logger  zerolog.Logger
+	options Options
+	tls     *tlsAssembler
+	quic    *quicAssembler
+	tcpDNS  *tcpDNSAssembler
+	local   *localNames
+}
+
+// Decode processes a single packet. Tunnels are looked through, so mirrored traffic is decoded
+// by its inner packet.
+func (d *Decoder) Decode(packet gopacket.Packet) {
+	inner := decapsulate(packet)
+	if tcp := inner.tcp; tcp != nil {
+		switch {
+		case d.isDNSPort(uint16(tcp.SrcPort)) || d.isDNSPort(uint16(tcp.DstPort)):
+			// DNS over TCP is length prefixed and may span segments, so per packet decoding isn't reliable
+			d.tcpDNS.assemble(inner.network.NetworkFlow(), tcp, timestampOf(packet))
+		case len(tcp.Payload) == 0:
+		case d.options.SNI && tcp.DstPort == HTTPSPort:
+			d.decodeTLS(tcp, inner.network.NetworkFlow(), timestampOf(packet))
+		case d.options.HTTP:
+			d.decodeHTTP(tcp.Payload, inner.network.NetworkFlow())
+		}
+		return
+	}
+	if udp := inner.udp; udp != nil {
+		if protocol, ok := d.localProtocol(udp); ok {
+			d.decodeLocal(udp.Payload, protocol, inner.network.NetworkFlow().Src().String())
+			return
+		}
+		if inner.dns == nil && (d.isDNSPort(uint16(udp.SrcPort)) || d.isDNSPort(uint16(udp.DstPort))) {
+			// gopacket only knows port 53, so custom ports are decoded here
+			dns := &layers.DNS{}
+			if err := dns.DecodeFromBytes(udp.Payload, gopacket.NilDecodeFeedback); err == nil {
+				d.decodeDNS(dns, inner.network.NetworkFlow())
+			}
+			return
+		}
+	}
+	if inner.dns != nil {
+		d.decodeDNS(inner.dns, inner.network.NetworkFlow())
+		return
+	}
+	if udp := inner.udp; udp != nil && d.options.SNI && udp.DstPort == HTTPSPort && len(udp.Payload) > 0 {
+		d.decodeQUIC(udp.Payload, inner.network.NetworkFlow(), timestampOf(packet))
+	}
+}
+
+func (d *Decoder) isDNSPort(port uint16) bool {
+	if port == DNSPort {
+		return true
+	}
+	for _, custom := range d.options.Ports {
+		if port == custom {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Decoder) localProtocol(udp *layers.UDP) (string, bool) {
+	if !d.options.Local {
+		return "", false
+	}
+	if protocol, ok := localProtocols[udp.DstPort]; ok {
+		return protocol, true
+	}
+	protocol, ok := localProtocols[udp.SrcPort]
+	return protocol, ok
+}
+
+// LocalNames returns how often each local name was seen, see Options.Local.
+func (d *Decoder) LocalNames() map[string]uint64 {
+	return d.local.snapshot()
+}
+
+// LocalNameStats returns a summary of the local names seen so far.
+func (d *Decoder) LocalNameStats() LocalNameStats {
+	return d.local.stats()
+}
+
+// decodeDNS handles a DNS message sent along flow. The client is the sender of a query and the
+// receiver of a response.
+func (d *Decoder) decodeDNS(dns *layers.DNS, flow gopacket.Flow) {
+	client := flow.Src()
+	if dns.QR {
+		client = flow.Dst()
+	}
+	for _, question := range dns.Questions {
+		if question.Type != layers.DNSTypeA && question.Type != layers.DNSTypeAAAA {
+			continue // Skip non-A and non-AAAA DNS questions
+		}
+		d.add(string(question.Name), client.String())
+	}
+}
+
+func (d *Decoder) decodeTLS(tcp *layers.TCP, flow gopacket.Flow, timestamp time.Time) {
+	name, err := d.tls.serverName(flow, tcp, timestamp)
+	if err != nil {
+		return
+	}
+	d.add(name, flow.Src().String())
+}
+
+func (d *Decoder) decodeHTTP(payload []byte, flow gopacket.Flow) {
+	name, err := HostFromHTTP(payload)
+	if err != nil {
+		return
+	}
+	d.add(name, flow.Src().String())
+}
+
+func (d *Decoder) decodeQUIC(payload []byte, flow gopacket.Flow, timestamp time.Time) {
+	name, err := d.quic.serverName(payload, timestamp)
+	if err != nil {
+		return
+	}
+	d.add(name, flow.Src().String())
+}
+
+// timestampOf returns the capture time of a packet, or now for packets built without metadata.
+func timestampOf(packet gopacket.Packet) time.Time {
+	if timestamp := packet.Metadata().Timestamp; !timestamp.IsZero() {
+		return timestamp
+	}
+	return time.Now()
+}
+
+func (d *Decoder) add(name, client string) {
+	d.queue.AddFrom(name, client)
+}
+
+// NewDecoder creates a decoder that always handles DNS and whatever else options enable.
+func NewDecoder(queue *models.DomainQueue, logger zerolog.Logger, options Options) *Decoder {
+	decoder := &Decoder{
+		queue:   queue,
+		logger:  logger,
+		options: options,
+		tls:     newTLSAssembler(),
+		quic:    newQUICAssembler(),
+		local:   newLocalNames(logger),
+	}
+	decoder.tcpDNS = newTCPDNSAssembler(decoder.decodeDNS)
+	return decoder
+}
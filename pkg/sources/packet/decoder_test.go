@@ -0,0 +1,185 @@
+package packet
+
+import (
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+// buildPacket serializes an Ethernet/IPv4 frame around transport and payload and decodes it again.
+func buildPacket(transport gopacket.SerializableLayer, payload gopacket.SerializableLayer) (gopacket.Packet, error) {
+	ethernet := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version: 4,
+		TTL:     64,
+		SrcIP:   net.IP{192, 0, 2, 10},
+		DstIP:   net.IP{198, 51, 100, 1},
+	}
+	switch layer := transport.(type) {
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		_ = layer.SetNetworkLayerForChecksum(ip)
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		_ = layer.SetNetworkLayerForChecksum(ip)
+	}
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, options, ethernet, ip, transport, payload); err != nil {
+		return nil, err
+	}
+	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default), nil
+}
+
+type DecoderTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *DecoderTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *DecoderTestSuite) dnsPacket(name string, qtype layers.DNSType) gopacket.Packet {
+	dns := &layers.DNS{
+		ID:        1,
+		RD:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte(name), Type: qtype, Class: layers.DNSClassIN}},
+	}
+	packet, err := buildPacket(&layers.UDP{SrcPort: 40000, DstPort: 53}, dns)
+	suite.Require().NoError(err)
+	return packet
+}
+
+func (suite *DecoderTestSuite) TestDecodeDNS() {
+	decoder := NewDecoder(suite.queue, suite.logger, Options{})
+	decoder.Decode(suite.dnsPacket("www.example.com", layers.DNSTypeA))
+	decoder.Decode(suite.dnsPacket("ipv6.example.com", layers.DNSTypeAAAA))
+	decoder.Decode(suite.dnsPacket("example.com", layers.DNSTypeMX))
+	decoder.Decode(suite.dnsPacket("invalid", layers.DNSTypeA))
+
+	domains := suite.queue.Get()
+	sort.Strings(domains)
+	suite.Equal([]string{"ipv6.example.com", "www.example.com"}, domains)
+}
+
+// clientRecorder is a models.NameFilter that remembers the client of every name.
+type clientRecorder map[string]string
+
+func (r clientRecorder) Check(domain, client string) string {
+	r[domain] = client
+	return ""
+}
+
+func (suite *DecoderTestSuite) TestDecodeDNSClient() {
+	clients := clientRecorder{}
+	queue := models.NewDomainQueue(NewMockCache(), 3600, models.WithNameFilter(clients))
+	decoder := NewDecoder(queue, suite.logger, Options{})
+	decoder.Decode(suite.dnsPacket("query.example.com", layers.DNSTypeA))
+	// buildPacket always sends from 192.0.2.10, so for a response that is the server
+	response := &layers.DNS{
+		ID:        1,
+		QR:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte("response.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+	}
+	packet, err := buildPacket(&layers.UDP{SrcPort: 53, DstPort: 40000}, response)
+	suite.Require().NoError(err)
+	decoder.Decode(packet)
+	suite.Equal(clientRecorder{"query.example.com": "192.0.2.10", "response.example.com": "198.51.100.1"}, clients)
+}
+
+func (suite *DecoderTestSuite) TestDecodeSNI() {
+	hello, err := generateClientHello("tls.example.com")
+	suite.Require().NoError(err)
+	tlsPacket, err := buildPacket(&layers.TCP{SrcPort: 40000, DstPort: HTTPSPort, PSH: true, ACK: true, Window: 1024}, gopacket.Payload(hello))
+	suite.Require().NoError(err)
+
+	cryptoData, err := quicClientHello("quic.example.com")
+	suite.Require().NoError(err)
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	datagram, err := sealInitial(quicVersion1, dcid, 0, encodeCryptoFrame(0, cryptoData))
+	suite.Require().NoError(err)
+	quicPacket, err := buildPacket(&layers.UDP{SrcPort: 40000, DstPort: HTTPSPort}, gopacket.Payload(datagram))
+	suite.Require().NoError(err)
+
+	// Without SNI enabled only DNS is looked at
+	decoder := NewDecoder(suite.queue, suite.logger, Options{})
+	decoder.Decode(tlsPacket)
+	decoder.Decode(quicPacket)
+	suite.Equal(0, suite.queue.Count())
+
+	decoder = NewDecoder(suite.queue, suite.logger, Options{SNI: true})
+	decoder.Decode(tlsPacket)
+	decoder.Decode(quicPacket)
+	domains := suite.queue.Get()
+	sort.Strings(domains)
+	suite.Equal([]string{"quic.example.com", "tls.example.com"}, domains)
+}
+
+func (suite *DecoderTestSuite) TestDecodeSNISegmented() {
+	hello, err := generateClientHello("segmented.example.com")
+	suite.Require().NoError(err)
+	decoder := NewDecoder(suite.queue, suite.logger, Options{SNI: true})
+	for offset := 0; offset < len(hello); offset += 100 {
+		segment := hello[offset:min(offset+100, len(hello))]
+		packet, err := buildPacket(&layers.TCP{SrcPort: 40000, DstPort: HTTPSPort, Seq: 5000 + uint32(offset), ACK: true, Window: 1024},
+			gopacket.Payload(segment))
+		suite.Require().NoError(err)
+		decoder.Decode(packet)
+	}
+	suite.Equal([]string{"segmented.example.com"}, suite.queue.Get())
+}
+
+func (suite *DecoderTestSuite) TestDecodeHTTP() {
+	request := "GET /index.html HTTP/1.1\r\nHost: plain.example.com:8080\r\nAccept: */*\r\n\r\n"
+	httpPacket, err := buildPacket(&layers.TCP{SrcPort: 40000, DstPort: 8080, PSH: true, ACK: true, Window: 1024}, gopacket.Payload(request))
+	suite.Require().NoError(err)
+
+	NewDecoder(suite.queue, suite.logger, Options{SNI: true}).Decode(httpPacket)
+	suite.Equal(0, suite.queue.Count())
+
+	NewDecoder(suite.queue, suite.logger, Options{HTTP: true}).Decode(httpPacket)
+	suite.Equal([]string{"plain.example.com"}, suite.queue.Get())
+}
+
+func TestDecoderTestSuite(t *testing.T) {
+	suite.Run(t, new(DecoderTestSuite))
+}
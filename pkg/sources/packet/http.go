@@ -0,0 +1,51 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+var (
+	errNotHTTP = errors.New("not an HTTP request")
+	errNoHost  = errors.New("no host in HTTP request")
+)
+
+// HostFromHTTP extracts the destination host of a plaintext HTTP/1.x request, e.g. the first
+// TCP segment of a connection to port 80. The request target wins over the Host header when it
+// names a host, as it does for CONNECT and requests sent to a forward proxy.
+func HostFromHTTP(payload []byte) (string, error) {
+	lineEnd := bytes.Index(payload, []byte("\r\n"))
+	if lineEnd < 0 {
+		return "", errNotHTTP
+	}
+	requestLine := strings.Fields(string(payload[:lineEnd]))
+	if len(requestLine) != 3 || !utils.HTTPMethods[requestLine[0]] || !strings.HasPrefix(requestLine[2], "HTTP/1.") {
+		return "", errNotHTTP
+	}
+	if host := utils.HostFromRequestTarget(requestLine[0], requestLine[1]); host != "" {
+		return host, nil
+	}
+
+	headers := payload[lineEnd+2:]
+	for len(headers) > 0 {
+		end := bytes.Index(headers, []byte("\r\n"))
+		if end <= 0 {
+			// End of the headers, or the segment was cut short
+			break
+		}
+		name, value, found := bytes.Cut(headers[:end], []byte(":"))
+		if found && strings.EqualFold(string(name), "Host") {
+			host := utils.StripPort(strings.TrimSpace(string(value)))
+			if host == "" || net.ParseIP(host) != nil {
+				return "", errNoHost
+			}
+			return host, nil
+		}
+		headers = headers[end+2:]
+	}
+	return "", errNoHost
+}
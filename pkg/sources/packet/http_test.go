@@ -0,0 +1,78 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type HTTPTestSuite struct {
+	suite.Suite
+}
+
+func (suite *HTTPTestSuite) TestHostFromHTTP() {
+	testCases := []struct {
+		name     string
+		payload  string
+		expected string
+		err      error
+	}{
+		{
+			name:     "Host header",
+			payload:  "GET / HTTP/1.1\r\nUser-Agent: curl/8.5.0\r\nHost: WWW.Example.com\r\n\r\n",
+			expected: "www.example.com",
+		},
+		{
+			name:     "Host header with port",
+			payload:  "POST /api HTTP/1.1\r\nhost: api.example.com:8080\r\nContent-Length: 0\r\n\r\n",
+			expected: "api.example.com",
+		},
+		{
+			name:     "Absolute URI to a proxy",
+			payload:  "GET http://proxied.example.org/x HTTP/1.1\r\nHost: other.example.org\r\n\r\n",
+			expected: "proxied.example.org",
+		},
+		{
+			name:     "CONNECT",
+			payload:  "CONNECT tunnel.example.net:443 HTTP/1.1\r\n\r\n",
+			expected: "tunnel.example.net",
+		},
+		{
+			name:    "Truncated headers",
+			payload: "GET / HTTP/1.1\r\nAccept: */*\r\nHost: cut.exam",
+			err:     errNoHost,
+		},
+		{
+			name:    "IP literal host",
+			payload: "GET / HTTP/1.1\r\nHost: [2001:db8::1]:8080\r\n\r\n",
+			err:     errNoHost,
+		},
+		{
+			name:    "HTTP/1.0 without host",
+			payload: "GET / HTTP/1.0\r\n\r\n",
+			err:     errNoHost,
+		},
+		{
+			name:    "Response",
+			payload: "HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n",
+			err:     errNotHTTP,
+		},
+		{
+			name:    "Binary",
+			payload: "\x16\x03\x01\x00\x05hello",
+			err:     errNotHTTP,
+		},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			host, err := HostFromHTTP([]byte(tc.payload))
+			suite.ErrorIs(err, tc.err)
+			suite.Equal(tc.expected, host)
+		})
+	}
+}
+
+func TestHTTPTestSuite(t *testing.T) {
+	suite.Run(t, new(HTTPTestSuite))
+}
@@ -0,0 +1,151 @@
+package packet
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+)
+
+const (
+	MDNSPort      = 5353
+	LLMNRPort     = 5355
+	NetBIOSNSPort = 137
+	// maxLocalNames caps how many distinct local names are counted individually
+	maxLocalNames = 10000
+	// netBIOSEncodedLength is the length of a first level encoded NetBIOS name, RFC 1001 section 14.1
+	netBIOSEncodedLength = 32
+)
+
+// localProtocols are the link local name resolution protocols, keyed by their UDP port.
+var localProtocols = map[layers.UDPPort]string{
+	MDNSPort:      "mDNS",
+	LLMNRPort:     "LLMNR",
+	NetBIOSNSPort: "NetBIOS-NS",
+}
+
+// LocalNameStats summarises the local names seen so far.
+type LocalNameStats struct {
+	// Distinct is the number of different names, up to maxLocalNames.
+	Distinct int
+	// Total counts every sighting, including names past the cap.
+	Total uint64
+}
+
+// localNames counts names that aren't submitted because they only make sense on the local network,
+// e.g. .local and single label names. Seeing them on the wire is still worth reporting.
+type localNames struct {
+	logger zerolog.Logger
+	counts map[string]uint64
+	total  uint64
+	lock   sync.Mutex
+}
+
+func (l *localNames) observe(protocol, name, client string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.total++
+	if _, ok := l.counts[name]; !ok {
+		if len(l.counts) >= maxLocalNames {
+			return
+		}
+		l.logger.Debug().Str("protocol", protocol).Str("name", name).Str("client", client).Msg("Local name seen on the wire")
+	}
+	l.counts[name]++
+}
+
+func (l *localNames) stats() LocalNameStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return LocalNameStats{Distinct: len(l.counts), Total: l.total}
+}
+
+func (l *localNames) snapshot() map[string]uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	counts := make(map[string]uint64, len(l.counts))
+	for name, count := range l.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+func newLocalNames(logger zerolog.Logger) *localNames {
+	return &localNames{
+		logger: logger,
+		counts: make(map[string]uint64),
+	}
+}
+
+// decodeLocal handles an mDNS, LLMNR or NetBIOS-NS message. A and AAAA questions for valid names
+// are submitted like plain DNS, names that fail validation are counted as local names.
+func (d *Decoder) decodeLocal(payload []byte, protocol, client string) {
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return
+	}
+	type localName struct {
+		name   string
+		submit bool
+	}
+	names := make([]localName, 0, len(dns.Questions)+len(dns.Answers))
+	for _, question := range dns.Questions {
+		submit := question.Type == layers.DNSTypeA || question.Type == layers.DNSTypeAAAA
+		names = append(names, localName{name: string(question.Name), submit: submit})
+	}
+	for _, answer := range dns.Answers {
+		names = append(names, localName{name: string(answer.Name)})
+	}
+	seen := make(map[string]bool, len(names))
+	for _, entry := range names {
+		name := entry.name
+		if protocol == localProtocols[NetBIOSNSPort] {
+			var ok bool
+			if name, ok = decodeNetBIOSName(name); !ok {
+				continue
+			}
+		}
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch {
+		case !utils.IsValidDomain(name):
+			d.local.observe(protocol, name, client)
+		case entry.submit:
+			d.queue.AddFrom(name, client)
+		}
+	}
+}
+
+// decodeNetBIOSName reverses the first level encoding of a NetBIOS name, dropping the
+// scope, the padding and the suffix byte that tells the service type.
+func decodeNetBIOSName(encoded string) (string, bool) {
+	label, _, _ := strings.Cut(encoded, ".")
+	if len(label) != netBIOSEncodedLength {
+		return "", false
+	}
+	decoded := make([]byte, netBIOSEncodedLength/2)
+	for i := range decoded {
+		high, low := label[2*i]-'A', label[2*i+1]-'A'
+		if high > 0x0f || low > 0x0f {
+			return "", false
+		}
+		decoded[i] = high<<4 | low
+	}
+	name := strings.TrimRight(string(decoded[:len(decoded)-1]), " ")
+	// "*" is the wildcard used by node status queries
+	if name == "" || name[0] == '*' {
+		return "", false
+	}
+	for _, c := range []byte(name) {
+		if c < 0x21 || c > 0x7e {
+			return "", false
+		}
+	}
+	return name, true
+}
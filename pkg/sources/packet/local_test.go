@@ -0,0 +1,115 @@
+package packet
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// encodeNetBIOSName applies the first level encoding of RFC 1001 to a name and suffix byte.
+func encodeNetBIOSName(name string, suffix byte) string {
+	padded := make([]byte, 16)
+	copy(padded, name+"               ")
+	padded[15] = suffix
+	encoded := make([]byte, 0, netBIOSEncodedLength)
+	for _, c := range padded {
+		encoded = append(encoded, 'A'+c>>4, 'A'+c&0x0f)
+	}
+	return string(encoded)
+}
+
+func (suite *DecoderTestSuite) udpDNSPacket(port layers.UDPPort, questions ...layers.DNSQuestion) gopacket.Packet {
+	packet, err := buildPacket(&layers.UDP{SrcPort: port, DstPort: port}, &layers.DNS{Questions: questions})
+	suite.Require().NoError(err)
+	return packet
+}
+
+func (suite *DecoderTestSuite) TestDecodeLocal() {
+	mdns := suite.udpDNSPacket(MDNSPort,
+		layers.DNSQuestion{Name: []byte("printer.local"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+		layers.DNSQuestion{Name: []byte("_ipp._tcp.local"), Type: layers.DNSTypePTR, Class: layers.DNSClassIN},
+		layers.DNSQuestion{Name: []byte("www.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+		layers.DNSQuestion{Name: []byte("10.2.0.192.in-addr.arpa"), Type: layers.DNSTypePTR, Class: layers.DNSClassIN},
+	)
+	llmnr := suite.udpDNSPacket(LLMNRPort,
+		layers.DNSQuestion{Name: []byte("FileServer"), Type: layers.DNSTypeAAAA, Class: layers.DNSClassIN})
+	netbios := suite.udpDNSPacket(NetBIOSNSPort,
+		layers.DNSQuestion{Name: []byte(encodeNetBIOSName("WORKSTATION", 0x20)), Type: 0x20, Class: layers.DNSClassIN})
+
+	// Without Local these are left alone
+	decoder := NewDecoder(suite.queue, suite.logger, Options{})
+	for _, packet := range []gopacket.Packet{mdns, llmnr, netbios} {
+		decoder.Decode(packet)
+	}
+	suite.Equal(0, suite.queue.Count())
+	suite.Empty(decoder.LocalNames())
+
+	decoder = NewDecoder(suite.queue, suite.logger, Options{Local: true})
+	for _, packet := range []gopacket.Packet{mdns, llmnr, netbios, llmnr} {
+		decoder.Decode(packet)
+	}
+	suite.Equal([]string{"www.example.com"}, suite.queue.Get())
+	suite.Equal(map[string]uint64{
+		"printer.local":   1,
+		"_ipp._tcp.local": 1,
+		"fileserver":      2,
+		"workstation":     1,
+	}, decoder.LocalNames())
+	suite.Equal(LocalNameStats{Distinct: 4, Total: 5}, decoder.LocalNameStats())
+}
+
+func (suite *DecoderTestSuite) TestDecodeCustomPorts() {
+	question := layers.DNSQuestion{Name: []byte("crypt.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}
+	udpPacket := suite.udpDNSPacket(5053, question)
+
+	NewDecoder(suite.queue, suite.logger, Options{}).Decode(udpPacket)
+	suite.Equal(0, suite.queue.Count())
+
+	NewDecoder(suite.queue, suite.logger, Options{Ports: []uint16{5053}}).Decode(udpPacket)
+	suite.Equal([]string{"crypt.example.com"}, suite.queue.Get())
+
+	// TCP on a custom port goes through reassembly
+	stream, err := framedDNS("tcp.example.net")
+	suite.Require().NoError(err)
+	synPacket, err := buildPacket(&layers.TCP{SrcPort: 40000, DstPort: 5053, Seq: 0, SYN: true, Window: 1024}, gopacket.Payload(nil))
+	suite.Require().NoError(err)
+	tcpPacket, err := buildPacket(&layers.TCP{SrcPort: 40000, DstPort: 5053, Seq: 1, ACK: true, PSH: true, Window: 1024},
+		gopacket.Payload(stream))
+	suite.Require().NoError(err)
+	decoder := NewDecoder(suite.queue, suite.logger, Options{Ports: []uint16{5053}})
+	decoder.Decode(synPacket)
+	decoder.Decode(tcpPacket)
+	suite.Equal([]string{"tcp.example.net"}, suite.queue.Get())
+}
+
+func (suite *DecoderTestSuite) TestLocalNamesCap() {
+	names := newLocalNames(suite.logger)
+	for i := 0; i < maxLocalNames+10; i++ {
+		names.observe("mDNS", string(rune('a'+i%26))+string(rune(i)), "192.0.2.1")
+	}
+	stats := names.stats()
+	suite.Equal(maxLocalNames, stats.Distinct)
+	suite.Equal(uint64(maxLocalNames+10), stats.Total)
+}
+
+func (suite *DecoderTestSuite) TestDecodeNetBIOSName() {
+	testCases := []struct {
+		name     string
+		encoded  string
+		expected string
+		ok       bool
+	}{
+		{name: "Workstation", encoded: encodeNetBIOSName("WORKSTATION", 0x00), expected: "WORKSTATION", ok: true},
+		{name: "With scope", encoded: encodeNetBIOSName("FS01", 0x20) + ".corp.example.com", expected: "FS01", ok: true},
+		{name: "Wildcard", encoded: encodeNetBIOSName("*", 0x00)},
+		{name: "Short", encoded: "EBEC"},
+		{name: "Not encoded", encoded: "www.example.com.www.example.com.ab"},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			name, ok := decodeNetBIOSName(tc.encoded)
+			suite.Equal(tc.ok, ok)
+			suite.Equal(tc.expected, name)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package packet
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// DecodePcap reads a pcap stream, as written by tcpdump -w -, and decodes every packet in it.
+// It returns once the stream ends.
+func (d *Decoder) DecodePcap(stream io.Reader) error {
+	reader, err := pcapgo.NewReader(stream)
+	if err != nil {
+		return fmt.Errorf("error reading pcap header: %w", err)
+	}
+	packetSource := gopacket.NewPacketSource(reader, reader.LinkType())
+	for pkt := range packetSource.Packets() {
+		d.Decode(pkt)
+	}
+	return nil
+}
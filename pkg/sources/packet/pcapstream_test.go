@@ -0,0 +1,62 @@
+package packet
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapStream writes what tcpdump -w - would for a DNS query per name, with a Linux cooked header like on "any".
+func pcapStream(names ...string) ([]byte, error) {
+	var stream bytes.Buffer
+	writer := pcapgo.NewWriter(&stream)
+	if err := writer.WriteFileHeader(65535, layers.LinkTypeLinuxSLL); err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{192, 168, 1, 1}, DstIP: net.IP{8, 8, 8, 8}}
+		udp := &layers.UDP{SrcPort: 54321, DstPort: 53}
+		if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+			return nil, err
+		}
+		dns := &layers.DNS{
+			ID:        uint16(i),
+			RD:        true,
+			Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		}
+		buffer := gopacket.NewSerializeBuffer()
+		options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buffer, options, ip, udp, dns); err != nil {
+			return nil, err
+		}
+		// Linux cooked capture header: packet type, ARPHRD_ETHER, address length, address, protocol
+		frame := []byte{0, 0, 0, 1, 0, 6, 2, 0, 0, 0, 0, 1, 0, 0, 0x08, 0x00}
+		frame = append(frame, buffer.Bytes()...)
+		ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame)}
+		if err := writer.WritePacket(ci, frame); err != nil {
+			return nil, err
+		}
+	}
+	return stream.Bytes(), nil
+}
+
+func (suite *DecoderTestSuite) TestDecodePcap() {
+	stream, err := pcapStream("example.com", "test.example.org", "invalid")
+	suite.Require().NoError(err)
+
+	decoder := NewDecoder(suite.queue, suite.logger, Options{})
+	suite.NoError(decoder.DecodePcap(bytes.NewReader(stream)))
+	suite.ElementsMatch([]string{"example.com", "test.example.org"}, suite.queue.Get())
+}
+
+func (suite *DecoderTestSuite) TestDecodePcapInvalidStream() {
+	decoder := NewDecoder(suite.queue, suite.logger, Options{})
+	suite.Error(decoder.DecodePcap(strings.NewReader("tcpdump: any: You don't have permission")))
+	suite.Error(decoder.DecodePcap(strings.NewReader("")))
+	suite.Equal(0, suite.queue.Count())
+}
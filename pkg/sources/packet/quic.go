@@ -0,0 +1,323 @@
+package packet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	quicVersion1 = 0x00000001
+	quicVersion2 = 0x6b3343cf
+	// Frame types we need to walk past to reach the CRYPTO frames of an Initial packet
+	quicFramePadding  = 0x00
+	quicFramePing     = 0x01
+	quicFrameACK      = 0x02
+	quicFrameACKECN   = 0x03
+	quicFrameCrypto   = 0x06
+	quicMaxCIDLength  = 20
+	quicSampleLength  = 16
+	quicMaxCryptoSize = 64 * 1024
+	// Chrome and friends split large ClientHellos over several Initial packets,
+	// partial ones are kept per connection ID for a short while.
+	quicMaxStreams    = 4096
+	quicStreamTimeout = 10 * time.Second
+)
+
+var (
+	quicV1Salt = []byte{
+		0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+	}
+	quicV2Salt = []byte{
+		0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+		0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9,
+	}
+	errNotQUICInitial = errors.New("not a QUIC initial packet")
+	errQUICMalformed  = errors.New("malformed QUIC packet")
+)
+
+// initialKeys is the client side packet protection material of the Initial space, RFC 9001 section 5.2.
+type initialKeys struct {
+	key []byte
+	iv  []byte
+	hp  []byte
+}
+
+func clientInitialKeys(version uint32, dcid []byte) (initialKeys, error) {
+	salt, labelPrefix := quicV1Salt, "quic "
+	if version == quicVersion2 {
+		salt, labelPrefix = quicV2Salt, "quicv2 "
+	}
+	initialSecret, err := hkdf.Extract(sha256.New, dcid, salt)
+	if err != nil {
+		return initialKeys{}, err
+	}
+	clientSecret, err := hkdfExpandLabel(initialSecret, "client in", sha256.Size)
+	if err != nil {
+		return initialKeys{}, err
+	}
+	var keys initialKeys
+	if keys.key, err = hkdfExpandLabel(clientSecret, labelPrefix+"key", 16); err != nil {
+		return initialKeys{}, err
+	}
+	if keys.iv, err = hkdfExpandLabel(clientSecret, labelPrefix+"iv", 12); err != nil {
+		return initialKeys{}, err
+	}
+	if keys.hp, err = hkdfExpandLabel(clientSecret, labelPrefix+"hp", 16); err != nil {
+		return initialKeys{}, err
+	}
+	return keys, nil
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label from RFC 8446 section 7.1 with an empty context.
+func hkdfExpandLabel(secret []byte, label string, length int) ([]byte, error) {
+	fullLabel := "tls13 " + label
+	info := make([]byte, 0, 4+len(fullLabel))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, 0)
+	return hkdf.Expand(sha256.New, secret, string(info), length)
+}
+
+// decryptInitial removes header protection from a client Initial packet and decrypts its payload.
+// The datagram itself is left untouched.
+func decryptInitial(datagram []byte) (dcid []byte, plaintext []byte, err error) {
+	r := reader(datagram)
+	first, ok := r.uint8()
+	if !ok || first&0x80 == 0 {
+		return nil, nil, errNotQUICInitial
+	}
+	if len(r) < 4 {
+		return nil, nil, errNotQUICInitial
+	}
+	version := binary.BigEndian.Uint32(r)
+	r = r[4:]
+	packetType := (first & 0x30) >> 4
+	switch {
+	case version == quicVersion1 && packetType == 0:
+	case version == quicVersion2 && packetType == 1:
+	default:
+		return nil, nil, errNotQUICInitial
+	}
+	dcidLength, ok := r.uint8()
+	if !ok || dcidLength > quicMaxCIDLength {
+		return nil, nil, errQUICMalformed
+	}
+	dcid, ok = r.takeUpTo(int(dcidLength))
+	if !ok || !r.skipVector8() {
+		return nil, nil, errQUICMalformed
+	}
+	tokenLength, ok := r.varint()
+	if !ok || tokenLength > uint64(len(r)) || !r.skip(int(tokenLength)) {
+		return nil, nil, errQUICMalformed
+	}
+	length, ok := r.varint()
+	if !ok || length > uint64(len(r)) || length < 4+quicSampleLength {
+		return nil, nil, errQUICMalformed
+	}
+	pnOffset := len(datagram) - len(r)
+
+	keys, err := clientInitialKeys(version, dcid)
+	if err != nil {
+		return nil, nil, err
+	}
+	hpBlock, err := aes.NewCipher(keys.hp)
+	if err != nil {
+		return nil, nil, err
+	}
+	mask := make([]byte, aes.BlockSize)
+	hpBlock.Encrypt(mask, datagram[pnOffset+4:pnOffset+4+quicSampleLength])
+	first ^= mask[0] & 0x0f
+	pnLength := int(first&0x03) + 1
+
+	header := make([]byte, pnOffset+pnLength)
+	copy(header, datagram)
+	header[0] = first
+	var packetNumber uint64
+	for i := 0; i < pnLength; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		packetNumber = packetNumber<<8 | uint64(header[pnOffset+i])
+	}
+	nonce := make([]byte, len(keys.iv))
+	copy(nonce, keys.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(packetNumber >> (8 * i))
+	}
+
+	block, err := aes.NewCipher(keys.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err = aead.Open(nil, nonce, datagram[pnOffset+pnLength:pnOffset+int(length)], header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dcid, plaintext, nil
+}
+
+type cryptoFrame struct {
+	offset uint64
+	data   []byte
+}
+
+// cryptoFrames walks the frames of a decrypted Initial payload and returns its CRYPTO frames.
+func cryptoFrames(payload []byte) []cryptoFrame {
+	var frames []cryptoFrame
+	r := reader(payload)
+	for len(r) > 0 {
+		frameType, _ := r.varint()
+		switch frameType {
+		case quicFramePadding, quicFramePing:
+		case quicFrameACK, quicFrameACKECN:
+			// largest acknowledged, delay, range count, first range
+			var rangeCount uint64
+			for i := 0; i < 4; i++ {
+				value, ok := r.varint()
+				if !ok {
+					return frames
+				}
+				if i == 2 {
+					rangeCount = value
+				}
+			}
+			extra := rangeCount * 2
+			if frameType == quicFrameACKECN {
+				extra += 3
+			}
+			for i := uint64(0); i < extra; i++ {
+				if _, ok := r.varint(); !ok {
+					return frames
+				}
+			}
+		case quicFrameCrypto:
+			offset, ok := r.varint()
+			if !ok {
+				return frames
+			}
+			length, ok := r.varint()
+			if !ok || length > uint64(len(r)) {
+				return frames
+			}
+			data, _ := r.takeUpTo(int(length))
+			frames = append(frames, cryptoFrame{offset: offset, data: data})
+		default:
+			// Anything else isn't allowed before the handshake is under way
+			return frames
+		}
+	}
+	return frames
+}
+
+// varint reads a QUIC variable-length integer, RFC 9000 section 16.
+func (r *reader) varint() (uint64, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	length := 1 << ((*r)[0] >> 6)
+	if len(*r) < length {
+		*r = nil
+		return 0, false
+	}
+	value := uint64((*r)[0] & 0x3f)
+	for i := 1; i < length; i++ {
+		value = value<<8 | uint64((*r)[i])
+	}
+	*r = (*r)[length:]
+	return value, true
+}
+
+// cryptoStream collects the CRYPTO frames of one connection until the ClientHello is complete enough.
+type cryptoStream struct {
+	frames  []cryptoFrame
+	updated time.Time
+}
+
+// contiguous returns the handshake data available from offset 0 without gaps.
+func (s *cryptoStream) contiguous() []byte {
+	sort.Slice(s.frames, func(i, j int) bool {
+		return s.frames[i].offset < s.frames[j].offset
+	})
+	var result []byte
+	for _, frame := range s.frames {
+		end := uint64(len(result))
+		if frame.offset > end {
+			break
+		}
+		if frame.offset+uint64(len(frame.data)) > end {
+			result = append(result, frame.data[end-frame.offset:]...)
+		}
+	}
+	return result
+}
+
+type quicAssembler struct {
+	streams map[string]*cryptoStream
+	lock    sync.Mutex
+}
+
+// serverName decrypts a client Initial datagram and returns the SNI once the ClientHello has it.
+// errIncomplete means more Initial packets for the same connection are needed.
+func (a *quicAssembler) serverName(datagram []byte, now time.Time) (string, error) {
+	dcid, plaintext, err := decryptInitial(datagram)
+	if err != nil {
+		return "", err
+	}
+	frames := cryptoFrames(plaintext)
+	if len(frames) == 0 {
+		return "", errNoSNI
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	key := string(dcid)
+	stream, ok := a.streams[key]
+	if !ok {
+		a.expire(now)
+		stream = &cryptoStream{}
+		a.streams[key] = stream
+	}
+	stream.updated = now
+	for _, frame := range frames {
+		if frame.offset+uint64(len(frame.data)) > quicMaxCryptoSize {
+			continue
+		}
+		stream.frames = append(stream.frames, frame)
+	}
+	name, err := serverNameFromHandshake(stream.contiguous())
+	if !errors.Is(err, errIncomplete) {
+		delete(a.streams, key)
+	}
+	return name, err
+}
+
+func (a *quicAssembler) expire(now time.Time) {
+	if len(a.streams) < quicMaxStreams {
+		return
+	}
+	for key, stream := range a.streams {
+		if now.Sub(stream.updated) > quicStreamTimeout {
+			delete(a.streams, key)
+		}
+	}
+	if len(a.streams) >= quicMaxStreams {
+		a.streams = make(map[string]*cryptoStream)
+	}
+}
+
+func newQUICAssembler() *quicAssembler {
+	return &quicAssembler{
+		streams: make(map[string]*cryptoStream),
+	}
+}
@@ -0,0 +1,201 @@
+package packet
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// quicClientHello returns the Initial level CRYPTO stream of a Go QUIC client connecting to serverName.
+func quicClientHello(serverName string) ([]byte, error) {
+	conn := tls.QUICClient(&tls.QUICConfig{
+		TLSConfig: &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS13, NextProtos: []string{"h3"}},
+	})
+	defer conn.Close()
+	conn.SetTransportParameters(nil)
+	if err := conn.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	var data []byte
+	for {
+		event := conn.NextEvent()
+		if event.Kind == tls.QUICNoEvent {
+			return data, nil
+		}
+		if event.Kind == tls.QUICWriteData && event.Level == tls.QUICEncryptionLevelInitial {
+			data = append(data, event.Data...)
+		}
+	}
+}
+
+// encodeCryptoFrame encodes a CRYPTO frame with two byte varints.
+func encodeCryptoFrame(offset int, data []byte) []byte {
+	frame := []byte{quicFrameCrypto}
+	frame = binary.BigEndian.AppendUint16(frame, 0x4000|uint16(offset))
+	frame = binary.BigEndian.AppendUint16(frame, 0x4000|uint16(len(data)))
+	return append(frame, data...)
+}
+
+// sealInitial protects payload as a client Initial packet, the reverse of decryptInitial.
+func sealInitial(version uint32, dcid []byte, packetNumber uint16, payload []byte) ([]byte, error) {
+	keys, err := clientInitialKeys(version, dcid)
+	if err != nil {
+		return nil, err
+	}
+	// Pad like real clients do, it also guarantees enough ciphertext for the header protection sample
+	for len(payload) < 1100 {
+		payload = append(payload, quicFramePadding)
+	}
+	first := byte(0xc1) // long header, Initial, 2 byte packet number
+	if version == quicVersion2 {
+		first = 0xd1
+	}
+	header := []byte{first}
+	header = binary.BigEndian.AppendUint32(header, version)
+	header = append(header, byte(len(dcid)))
+	header = append(header, dcid...)
+	header = append(header, 0, 0) // empty SCID and token
+	header = binary.BigEndian.AppendUint16(header, 0x4000|uint16(2+len(payload)+16))
+	pnOffset := len(header)
+	header = binary.BigEndian.AppendUint16(header, packetNumber)
+
+	block, err := aes.NewCipher(keys.key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := append([]byte(nil), keys.iv...)
+	nonce[len(nonce)-1] ^= byte(packetNumber)
+	nonce[len(nonce)-2] ^= byte(packetNumber >> 8)
+	datagram := aead.Seal(append([]byte(nil), header...), nonce, payload, header)
+
+	hpBlock, err := aes.NewCipher(keys.hp)
+	if err != nil {
+		return nil, err
+	}
+	mask := make([]byte, aes.BlockSize)
+	hpBlock.Encrypt(mask, datagram[pnOffset+4:pnOffset+4+quicSampleLength])
+	datagram[0] ^= mask[0] & 0x0f
+	datagram[pnOffset] ^= mask[1]
+	datagram[pnOffset+1] ^= mask[2]
+	return datagram, nil
+}
+
+type QUICTestSuite struct {
+	suite.Suite
+	dcid []byte
+}
+
+func (suite *QUICTestSuite) SetupTest() {
+	suite.dcid, _ = hex.DecodeString("8394c8f03e515708")
+}
+
+func (suite *QUICTestSuite) TestClientInitialKeys() {
+	// RFC 9001 appendix A.1
+	keys, err := clientInitialKeys(quicVersion1, suite.dcid)
+	suite.Require().NoError(err)
+	suite.Equal("1f369613dd76d5467730efcbe3b1a22d", hex.EncodeToString(keys.key))
+	suite.Equal("fa044b2f42a3fd3b46fb255c", hex.EncodeToString(keys.iv))
+	suite.Equal("9f50449e04a0e810283a1e9933adedd2", hex.EncodeToString(keys.hp))
+}
+
+func (suite *QUICTestSuite) TestServerName() {
+	for _, version := range []uint32{quicVersion1, quicVersion2} {
+		hello, err := quicClientHello("www.example.com")
+		suite.Require().NoError(err)
+		datagram, err := sealInitial(version, suite.dcid, 0, encodeCryptoFrame(0, hello))
+		suite.Require().NoError(err)
+
+		name, err := newQUICAssembler().serverName(datagram, time.Now())
+		suite.NoError(err)
+		suite.Equal("www.example.com", name)
+	}
+}
+
+func (suite *QUICTestSuite) TestServerNameAcrossPackets() {
+	hello, err := quicClientHello("split.example.org")
+	suite.Require().NoError(err)
+	half := len(hello) / 2
+	assembler := newQUICAssembler()
+
+	// The second half arrives first and in its own packet, preceded by an ACK frame
+	ack := []byte{quicFrameACK, 0x00, 0x00, 0x00, 0x00}
+	second, err := sealInitial(quicVersion1, suite.dcid, 1, append(ack, encodeCryptoFrame(half, hello[half:])...))
+	suite.Require().NoError(err)
+	_, err = assembler.serverName(second, time.Now())
+	suite.ErrorIs(err, errIncomplete)
+
+	// The first packet carries its CRYPTO frames out of order, as Chrome does
+	quarter := half / 2
+	payload := append(encodeCryptoFrame(quarter, hello[quarter:half]), encodeCryptoFrame(0, hello[:quarter])...)
+	first, err := sealInitial(quicVersion1, suite.dcid, 0, payload)
+	suite.Require().NoError(err)
+	name, err := assembler.serverName(first, time.Now())
+	suite.NoError(err)
+	suite.Equal("split.example.org", name)
+	suite.Empty(assembler.streams)
+}
+
+func (suite *QUICTestSuite) TestNotInitial() {
+	assembler := newQUICAssembler()
+	testCases := []struct {
+		name     string
+		datagram []byte
+	}{
+		{name: "Short header", datagram: []byte{0x40, 0x01, 0x02, 0x03}},
+		{name: "Unknown version", datagram: []byte{0xc0, 0xff, 0x00, 0x00, 0x1d, 0x00}},
+		{name: "Handshake packet", datagram: []byte{0xe0, 0x00, 0x00, 0x00, 0x01, 0x00}},
+		{name: "Empty", datagram: nil},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			_, err := assembler.serverName(tc.datagram, time.Now())
+			suite.ErrorIs(err, errNotQUICInitial)
+		})
+	}
+}
+
+func (suite *QUICTestSuite) TestCorrupted() {
+	hello, err := quicClientHello("www.example.com")
+	suite.Require().NoError(err)
+	datagram, err := sealInitial(quicVersion1, suite.dcid, 0, encodeCryptoFrame(0, hello))
+	suite.Require().NoError(err)
+	datagram[len(datagram)-1] ^= 0xff
+
+	_, err = newQUICAssembler().serverName(datagram, time.Now())
+	suite.Error(err)
+	suite.Error(func() error { _, err := newQUICAssembler().serverName(datagram[:40], time.Now()); return err }())
+}
+
+func (suite *QUICTestSuite) TestTokenLength() {
+	// Long header of a v1 Initial with an empty DCID and SCID, then an 8 byte varint token length
+	// that doesn't fit in an int on 32-bit platforms
+	datagram := []byte{0xc0, 0, 0, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0}
+	_, err := newQUICAssembler().serverName(datagram, time.Now())
+	suite.ErrorIs(err, errQUICMalformed)
+}
+
+func (suite *QUICTestSuite) TestExpire() {
+	assembler := newQUICAssembler()
+	now := time.Now()
+	for i := 0; i < quicMaxStreams; i++ {
+		assembler.streams[string(rune(i))] = &cryptoStream{updated: now.Add(-time.Minute)}
+	}
+	assembler.expire(now)
+	suite.Empty(assembler.streams)
+}
+
+func TestQUICTestSuite(t *testing.T) {
+	suite.Run(t, new(QUICTestSuite))
+}
@@ -0,0 +1,100 @@
+package packet
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+const (
+	DNSPort = 53
+	// Limits for buffered out of order segments, so that a lossy capture can't grow without bound
+	tcpMaxBufferedPagesTotal         = 4096
+	tcpMaxBufferedPagesPerConnection = 64
+	// Streams without traffic for this long are flushed and forgotten
+	tcpStreamTimeout = 2 * time.Minute
+	tcpFlushInterval = 30 * time.Second
+	// dnsLengthSize is the 2 byte message length prefixed to DNS over TCP, RFC 1035 section 4.2.2.
+	dnsLengthSize = 2
+)
+
+// dnsStream collects one direction of a DNS over TCP connection and cuts it into messages.
+type dnsStream struct {
+	buffer []byte
+	flow   gopacket.Flow // Network flow of this direction
+	handle func(*layers.DNS, gopacket.Flow)
+}
+
+func (s *dnsStream) Reassembled(reassemblies []tcpassembly.Reassembly) {
+	for _, reassembly := range reassemblies {
+		if reassembly.Skip != 0 {
+			// Bytes were lost, the length framing can't be trusted anymore
+			s.buffer = nil
+		}
+		s.buffer = append(s.buffer, reassembly.Bytes...)
+		s.split()
+	}
+}
+
+func (s *dnsStream) ReassemblyComplete() {
+	s.buffer = nil
+}
+
+// split decodes every complete length prefixed message in the buffer and keeps the remainder.
+func (s *dnsStream) split() {
+	for len(s.buffer) >= dnsLengthSize {
+		length := int(binary.BigEndian.Uint16(s.buffer))
+		if len(s.buffer) < dnsLengthSize+length {
+			break
+		}
+		dns := &layers.DNS{}
+		if err := dns.DecodeFromBytes(s.buffer[dnsLengthSize:dnsLengthSize+length], gopacket.NilDecodeFeedback); err == nil {
+			s.handle(dns, s.flow)
+		}
+		s.buffer = s.buffer[dnsLengthSize+length:]
+	}
+	if len(s.buffer) == 0 {
+		s.buffer = nil
+	}
+}
+
+type dnsStreamFactory struct {
+	handle func(*layers.DNS, gopacket.Flow)
+}
+
+func (f *dnsStreamFactory) New(flow, _ gopacket.Flow) tcpassembly.Stream {
+	return &dnsStream{flow: flow, handle: f.handle}
+}
+
+// tcpDNSAssembler reassembles DNS over TCP, which is often split across segments or carries
+// several messages in one, e.g. zone transfers and large DNSSEC answers.
+type tcpDNSAssembler struct {
+	assembler *tcpassembly.Assembler
+	lastFlush time.Time
+	lock      sync.Mutex
+}
+
+func (a *tcpDNSAssembler) assemble(flow gopacket.Flow, tcp *layers.TCP, timestamp time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.assembler.AssembleWithTimestamp(flow, tcp, timestamp)
+	if a.lastFlush.IsZero() {
+		a.lastFlush = timestamp
+	}
+	if timestamp.Sub(a.lastFlush) > tcpFlushInterval {
+		a.assembler.FlushOlderThan(timestamp.Add(-tcpStreamTimeout))
+		a.lastFlush = timestamp
+	}
+}
+
+func newTCPDNSAssembler(handle func(*layers.DNS, gopacket.Flow)) *tcpDNSAssembler {
+	pool := tcpassembly.NewStreamPool(&dnsStreamFactory{handle: handle})
+	assembler := tcpassembly.NewAssembler(pool)
+	assembler.MaxBufferedPagesTotal = tcpMaxBufferedPagesTotal
+	assembler.MaxBufferedPagesPerConnection = tcpMaxBufferedPagesPerConnection
+	return &tcpDNSAssembler{assembler: assembler}
+}
@@ -0,0 +1,71 @@
+package packet
+
+import (
+	"encoding/binary"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// framedDNS serializes a DNS query for each name with the 2 byte TCP length prefix.
+func framedDNS(names ...string) ([]byte, error) {
+	var stream []byte
+	for i, name := range names {
+		dns := &layers.DNS{
+			ID:        uint16(i + 1),
+			RD:        true,
+			Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		}
+		buffer := gopacket.NewSerializeBuffer()
+		if err := dns.SerializeTo(buffer, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+			return nil, err
+		}
+		stream = binary.BigEndian.AppendUint16(stream, uint16(len(buffer.Bytes())))
+		stream = append(stream, buffer.Bytes()...)
+	}
+	return stream, nil
+}
+
+func (suite *DecoderTestSuite) TestDNSStreamSplit() {
+	stream, err := framedDNS("one.example.com", "two.example.com", "three.example.com")
+	suite.Require().NoError(err)
+
+	var names []string
+	dnsStream := &dnsStream{handle: func(dns *layers.DNS, _ gopacket.Flow) {
+		names = append(names, string(dns.Questions[0].Name))
+	}}
+	// Cut inside the first length prefix and inside the second message
+	dnsStream.Reassembled([]tcpassembly.Reassembly{{Bytes: stream[:1]}})
+	suite.Empty(names)
+	dnsStream.Reassembled([]tcpassembly.Reassembly{{Bytes: stream[1:40]}, {Bytes: stream[40:]}})
+	suite.Equal([]string{"one.example.com", "two.example.com", "three.example.com"}, names)
+	suite.Nil(dnsStream.buffer)
+
+	// A gap resynchronises on the next segment
+	names = nil
+	dnsStream.Reassembled([]tcpassembly.Reassembly{{Bytes: stream[:10]}})
+	dnsStream.Reassembled([]tcpassembly.Reassembly{{Bytes: stream, Skip: 100}})
+	suite.Equal([]string{"one.example.com", "two.example.com", "three.example.com"}, names)
+}
+
+func (suite *DecoderTestSuite) TestDecodeDNSOverTCP() {
+	stream, err := framedDNS("tcp.example.com", "axfr.example.org")
+	suite.Require().NoError(err)
+	segment := func(seq uint32, syn bool, payload []byte) gopacket.Packet {
+		tcp := &layers.TCP{SrcPort: 40000, DstPort: DNSPort, Seq: seq, SYN: syn, ACK: !syn, PSH: !syn, Window: 1024}
+		packet, err := buildPacket(tcp, gopacket.Payload(payload))
+		suite.Require().NoError(err)
+		return packet
+	}
+	decoder := NewDecoder(suite.queue, suite.logger, Options{})
+	decoder.Decode(segment(1000, true, nil))
+	// Segments arrive out of order and the second message spans both of them
+	split := len(stream) - 20
+	decoder.Decode(segment(1001+uint32(split), false, stream[split:]))
+	suite.Equal(0, suite.queue.Count())
+	decoder.Decode(segment(1001, false, stream[:split]))
+
+	domains := suite.queue.Get()
+	suite.ElementsMatch([]string{"tcp.example.com", "axfr.example.org"}, domains)
+}
@@ -0,0 +1,244 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	tlsRecordHandshake  = 0x16
+	tlsClientHello      = 0x01
+	tlsExtServerName    = 0x0000
+	tlsServerNameHost   = 0x00
+	tlsRecordHeaderSize = 5
+	// A ClientHello with a post-quantum key share is bigger than a segment and extension order is
+	// shuffled, so the SNI is often in a later segment. The start of a connection is buffered
+	// until the ClientHello is complete enough, like QUIC CRYPTO frames.
+	tlsMaxHelloSize  = 16 * 1024
+	tlsMaxStreams    = 4096
+	tlsStreamTimeout = 10 * time.Second
+)
+
+var (
+	// errIncomplete means the data ended before the server name could be found.
+	errIncomplete = errors.New("incomplete client hello")
+	errNoSNI      = errors.New("no server name indication")
+	errNotHello   = errors.New("not a client hello")
+)
+
+// ServerNameFromTLS extracts the SNI from TLS records carrying a ClientHello, e.g. the start of a
+// TCP connection to port 443. Truncated data is parsed as far as it goes.
+func ServerNameFromTLS(payload []byte) (string, error) {
+	var handshake []byte
+	for len(payload) >= tlsRecordHeaderSize {
+		if payload[0] != tlsRecordHandshake {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(payload[3:5]))
+		payload = payload[tlsRecordHeaderSize:]
+		if length > len(payload) {
+			length = len(payload)
+		}
+		handshake = append(handshake, payload[:length]...)
+		payload = payload[length:]
+	}
+	if len(handshake) == 0 {
+		return "", errNotHello
+	}
+	return serverNameFromHandshake(handshake)
+}
+
+// tlsStreamKey identifies one direction of a TCP connection.
+type tlsStreamKey struct {
+	network   gopacket.Flow
+	transport gopacket.Flow
+}
+
+// tlsStream collects the segments of a connection that started with a TLS handshake record.
+type tlsStream struct {
+	cryptoStream
+	start uint32 // Sequence number of the first record byte
+}
+
+type tlsAssembler struct {
+	streams map[tlsStreamKey]*tlsStream
+	lock    sync.Mutex
+}
+
+// serverName returns the SNI once the segments seen so far of the connection tcp belongs to have it.
+// errIncomplete means more segments are needed.
+func (a *tlsAssembler) serverName(network gopacket.Flow, tcp *layers.TCP, now time.Time) (string, error) {
+	key := tlsStreamKey{network: network, transport: tcp.TransportFlow()}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	stream, ok := a.streams[key]
+	if !ok {
+		// Most ClientHellos still fit in one segment
+		name, err := ServerNameFromTLS(tcp.Payload)
+		if !errors.Is(err, errIncomplete) {
+			return name, err
+		}
+		a.expire(now)
+		stream = &tlsStream{start: tcp.Seq}
+		a.streams[key] = stream
+	}
+	stream.updated = now
+	// Sequence numbers wrap, segments from before the start end up far beyond the limit
+	offset := uint64(tcp.Seq - stream.start)
+	if offset+uint64(len(tcp.Payload)) <= tlsMaxHelloSize {
+		stream.frames = append(stream.frames, cryptoFrame{offset: offset, data: append([]byte(nil), tcp.Payload...)})
+	}
+	name, err := ServerNameFromTLS(stream.contiguous())
+	if !errors.Is(err, errIncomplete) {
+		delete(a.streams, key)
+	}
+	return name, err
+}
+
+func (a *tlsAssembler) expire(now time.Time) {
+	if len(a.streams) < tlsMaxStreams {
+		return
+	}
+	for key, stream := range a.streams {
+		if now.Sub(stream.updated) > tlsStreamTimeout {
+			delete(a.streams, key)
+		}
+	}
+	if len(a.streams) >= tlsMaxStreams {
+		a.streams = make(map[tlsStreamKey]*tlsStream)
+	}
+}
+
+func newTLSAssembler() *tlsAssembler {
+	return &tlsAssembler{
+		streams: make(map[tlsStreamKey]*tlsStream),
+	}
+}
+
+// serverNameFromHandshake extracts the SNI from a raw ClientHello handshake message,
+// which is what QUIC carries in its CRYPTO frames.
+func serverNameFromHandshake(data []byte) (string, error) {
+	r := reader(data)
+	msgType, ok := r.uint8()
+	if !ok {
+		return "", errIncomplete
+	}
+	if msgType != tlsClientHello {
+		return "", errNotHello
+	}
+	// length(3), legacy_version(2), random(32)
+	if !r.skip(3 + 2 + 32) {
+		return "", errIncomplete
+	}
+	// session_id, cipher_suites, compression_methods
+	if !r.skipVector8() || !r.skipVector16() || !r.skipVector8() {
+		return "", errIncomplete
+	}
+	extensionsLength, ok := r.uint16()
+	if !ok {
+		return "", errIncomplete
+	}
+	extensions, complete := r.takeUpTo(int(extensionsLength))
+	for len(extensions) > 0 {
+		extType, ok := extensions.uint16()
+		if !ok {
+			break
+		}
+		extLength, ok := extensions.uint16()
+		if !ok {
+			break
+		}
+		body, ok := extensions.takeUpTo(int(extLength))
+		if extType == tlsExtServerName {
+			if !ok {
+				return "", errIncomplete
+			}
+			return parseServerNameExtension(body)
+		}
+	}
+	if !complete {
+		return "", errIncomplete
+	}
+	return "", errNoSNI
+}
+
+func parseServerNameExtension(data reader) (string, error) {
+	if _, ok := data.uint16(); !ok {
+		return "", errNoSNI
+	}
+	for len(data) > 0 {
+		nameType, ok := data.uint8()
+		if !ok {
+			break
+		}
+		nameLength, ok := data.uint16()
+		if !ok {
+			break
+		}
+		name, ok := data.takeUpTo(int(nameLength))
+		if !ok {
+			break
+		}
+		if nameType == tlsServerNameHost {
+			return string(name), nil
+		}
+	}
+	return "", errNoSNI
+}
+
+// reader is a minimal big endian cursor over a byte slice.
+type reader []byte
+
+func (r *reader) uint8() (uint8, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *reader) uint16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *reader) skip(n int) bool {
+	if n < 0 || len(*r) < n {
+		*r = nil
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) skipVector8() bool {
+	n, ok := r.uint8()
+	return ok && r.skip(int(n))
+}
+
+func (r *reader) skipVector16() bool {
+	n, ok := r.uint16()
+	return ok && r.skip(int(n))
+}
+
+// takeUpTo returns up to n bytes and whether all n were available.
+func (r *reader) takeUpTo(n int) (reader, bool) {
+	if len(*r) < n {
+		v := *r
+		*r = nil
+		return v, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
@@ -0,0 +1,173 @@
+package packet
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/suite"
+)
+
+// generateClientHello returns the first TLS record a Go client sends when connecting to serverName.
+func generateClientHello(serverName string) ([]byte, error) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		defer client.Close()
+		_ = tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake() //nolint:gosec
+	}()
+	header := make([]byte, tlsRecordHeaderSize)
+	if _, err := io.ReadFull(server, header); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(server, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+type TLSTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TLSTestSuite) TestServerNameFromTLS() {
+	record, err := generateClientHello("www.example.com")
+	suite.Require().NoError(err)
+
+	name, err := ServerNameFromTLS(record)
+	suite.NoError(err)
+	suite.Equal("www.example.com", name)
+}
+
+func (suite *TLSTestSuite) TestServerNameFromTLSSplitRecords() {
+	record, err := generateClientHello("split.example.org")
+	suite.Require().NoError(err)
+	// Re-frame the handshake into two records, as some clients do
+	handshake := record[tlsRecordHeaderSize:]
+	half := len(handshake) / 2
+	var split []byte
+	for _, fragment := range [][]byte{handshake[:half], handshake[half:]} {
+		split = append(split, tlsRecordHandshake, 0x03, 0x01)
+		split = binary.BigEndian.AppendUint16(split, uint16(len(fragment)))
+		split = append(split, fragment...)
+	}
+
+	name, err := ServerNameFromTLS(split)
+	suite.NoError(err)
+	suite.Equal("split.example.org", name)
+}
+
+func (suite *TLSTestSuite) TestServerNameFromTLSErrors() {
+	record, err := generateClientHello("www.example.com")
+	suite.Require().NoError(err)
+	withoutSNI, err := generateClientHello("")
+	suite.Require().NoError(err)
+
+	testCases := []struct {
+		name     string
+		payload  []byte
+		expected error
+	}{
+		{name: "Truncated", payload: record[:60], expected: errIncomplete},
+		{name: "No SNI", payload: withoutSNI, expected: errNoSNI},
+		{name: "Application data", payload: []byte{0x17, 0x03, 0x03, 0x00, 0x01, 0x00}, expected: errNotHello},
+		{name: "Server hello", payload: []byte{0x16, 0x03, 0x03, 0x00, 0x01, 0x02}, expected: errNotHello},
+		{name: "Empty", payload: nil, expected: errNotHello},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			_, err := ServerNameFromTLS(tc.payload)
+			suite.ErrorIs(err, tc.expected)
+		})
+	}
+}
+
+// segments splits payload into TCP segments of size bytes starting at sequence number seq.
+func segments(payload []byte, seq uint32, size int) []*layers.TCP {
+	var result []*layers.TCP
+	for offset := 0; offset < len(payload); offset += size {
+		end := min(offset+size, len(payload))
+		result = append(result, &layers.TCP{
+			BaseLayer: layers.BaseLayer{Payload: payload[offset:end]},
+			SrcPort:   40000,
+			DstPort:   HTTPSPort,
+			Seq:       seq + uint32(offset),
+		})
+	}
+	return result
+}
+
+func (suite *TLSTestSuite) TestAssembler() {
+	record, err := generateClientHello("segmented.example.com")
+	suite.Require().NoError(err)
+	network := gopacket.NewFlow(layers.EndpointIPv4, net.IP{192, 0, 2, 10}.To4(), net.IP{198, 51, 100, 1}.To4())
+	other := gopacket.NewFlow(layers.EndpointIPv4, net.IP{192, 0, 2, 11}.To4(), net.IP{198, 51, 100, 1}.To4())
+	now := time.Now()
+
+	for _, seq := range []uint32{1000, math.MaxUint32 - 50} {
+		assembler := newTLSAssembler()
+		parts := segments(record, seq, 40)
+		suite.Require().Greater(len(parts), 3)
+		// Another connection starting at the same time doesn't get in the way
+		_, err = assembler.serverName(other, parts[0], now)
+		suite.ErrorIs(err, errIncomplete)
+
+		// A retransmission and a segment arriving early are both fine
+		order := append([]*layers.TCP{parts[0], parts[0], parts[2], parts[1]}, parts[3:]...)
+		var name string
+		for i, segment := range order {
+			if name, err = assembler.serverName(network, segment, now); !errors.Is(err, errIncomplete) {
+				suite.Greater(i, 3, "the server name isn't in the first segments")
+				break
+			}
+		}
+		suite.NoError(err)
+		suite.Equal("segmented.example.com", name)
+		suite.Len(assembler.streams, 1, "finished connections are forgotten")
+
+		// Later data on the connection isn't a handshake
+		_, err = assembler.serverName(network, &layers.TCP{BaseLayer: layers.BaseLayer{Payload: []byte{0x17, 0x03, 0x03, 0x00, 0x01, 0x00}},
+			SrcPort: 40000, DstPort: HTTPSPort, Seq: seq + uint32(len(record))}, now)
+		suite.ErrorIs(err, errNotHello)
+	}
+}
+
+func (suite *TLSTestSuite) TestAssemblerSingleSegment() {
+	record, err := generateClientHello("www.example.com")
+	suite.Require().NoError(err)
+	assembler := newTLSAssembler()
+	network := gopacket.NewFlow(layers.EndpointIPv4, net.IP{192, 0, 2, 10}.To4(), net.IP{198, 51, 100, 1}.To4())
+	name, err := assembler.serverName(network, segments(record, 1, len(record))[0], time.Now())
+	suite.NoError(err)
+	suite.Equal("www.example.com", name)
+	suite.Empty(assembler.streams)
+}
+
+func (suite *TLSTestSuite) TestAssemblerExpire() {
+	assembler := newTLSAssembler()
+	start := time.Now()
+	hello := []byte{tlsRecordHandshake, 0x03, 0x01, 0x02, 0x00, tlsClientHello}
+	for i := range tlsMaxStreams {
+		network := gopacket.NewFlow(layers.EndpointIPv4, net.IP{10, 0, byte(i >> 8), byte(i)}.To4(), net.IP{198, 51, 100, 1}.To4())
+		_, err := assembler.serverName(network, segments(hello, 1, len(hello))[0], start)
+		suite.ErrorIs(err, errIncomplete)
+	}
+	suite.Len(assembler.streams, tlsMaxStreams)
+	network := gopacket.NewFlow(layers.EndpointIPv4, net.IP{192, 0, 2, 10}.To4(), net.IP{198, 51, 100, 1}.To4())
+	_, err := assembler.serverName(network, segments(hello, 1, len(hello))[0], start.Add(2*tlsStreamTimeout))
+	suite.ErrorIs(err, errIncomplete)
+	suite.Len(assembler.streams, 1)
+}
+
+func TestTLSTestSuite(t *testing.T) {
+	suite.Run(t, new(TLSTestSuite))
+}
@@ -0,0 +1,87 @@
+package packet
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// TunnelFilter matches the carriers of mirrored traffic: VXLAN (AWS traffic mirroring), GENEVE
+// (AWS Gateway Load Balancer) and GRE, which also carries ERSPAN. BPF can't reliably look inside
+// them, so they are captured whole and the decoder skips inner packets it isn't interested in.
+const TunnelFilter = "udp port 4789 or udp port 6081 or ip proto 47 or ip6 proto 47"
+
+// TunnelBPF extends a BPF expression to also match its packets behind 802.1Q/QinQ tags and the
+// tunnel carriers the decoder looks through, for every source that captures with BPF.
+func TunnelBPF(filter string) string {
+	// Each vlan keyword moves the offsets of everything after it, so 802.1Q and QinQ are nested
+	return "(" + filter + ") or (" + TunnelFilter + ") or (vlan and ((" + filter + ") or (vlan and (" + filter + "))))"
+}
+
+const (
+	// gopacket decodes VXLAN, GENEVE, GRE, ERSPAN type II and 802.1Q/QinQ by itself,
+	// ERSPAN type III is the one carrier it doesn't know.
+	greProtocolERSPANIII     layers.EthernetType = 0x22eb
+	erspanIIIHeaderSize                          = 12
+	erspanIIIPlatformSubSize                     = 8
+	// maxTunnelDepth bounds how many ERSPAN III headers are peeled off one packet
+	maxTunnelDepth = 4
+)
+
+// innerLayers are the layers of the innermost packet, i.e. the mirrored traffic rather than its carrier.
+type innerLayers struct {
+	network gopacket.NetworkLayer
+	tcp     *layers.TCP
+	udp     *layers.UDP
+	dns     *layers.DNS
+}
+
+// decapsulate finds the innermost network, transport and DNS layers of a packet. For a packet
+// mirrored over VXLAN the outer UDP datagram to port 4789 is skipped in favour of the inner one.
+func decapsulate(packet gopacket.Packet) innerLayers {
+	var inner innerLayers
+	for depth := 0; depth < maxTunnelDepth; depth++ {
+		var gre *layers.GRE
+		for _, layer := range packet.Layers() {
+			switch layer := layer.(type) {
+			case *layers.IPv4, *layers.IPv6:
+				// A new network layer starts a new inner packet
+				inner = innerLayers{network: layer.(gopacket.NetworkLayer)}
+				gre = nil
+			case *layers.TCP:
+				inner.tcp, inner.udp = layer, nil
+			case *layers.UDP:
+				inner.udp, inner.tcp = layer, nil
+			case *layers.DNS:
+				inner.dns = layer
+			case *layers.GRE:
+				gre = layer
+			}
+		}
+		if gre == nil || gre.Protocol != greProtocolERSPANIII {
+			break
+		}
+		payload, ok := erspanIIIPayload(gre.LayerPayload())
+		if !ok {
+			break
+		}
+		packet = gopacket.NewPacket(payload, layers.LayerTypeEthernet, gopacket.Default)
+	}
+	return inner
+}
+
+// erspanIIIPayload strips the ERSPAN type III header and its optional platform specific
+// subheader, leaving the mirrored Ethernet frame.
+func erspanIIIPayload(data []byte) ([]byte, bool) {
+	if len(data) < erspanIIIHeaderSize {
+		return nil, false
+	}
+	headerSize := erspanIIIHeaderSize
+	// O flag, the last bit of the header
+	if data[erspanIIIHeaderSize-1]&0x01 != 0 {
+		headerSize += erspanIIIPlatformSubSize
+	}
+	if len(data) < headerSize {
+		return nil, false
+	}
+	return data[headerSize:], true
+}
@@ -0,0 +1,127 @@
+package packet
+
+import (
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+)
+
+// encapsulate serializes the outer layers of a tunnel around an already built inner frame.
+func encapsulate(inner []byte, outer ...gopacket.SerializableLayer) (gopacket.Packet, error) {
+	buffer := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true},
+		append(outer, gopacket.Payload(inner))...); err != nil {
+		return nil, err
+	}
+	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default), nil
+}
+
+func outerEthernet(ethernetType layers.EthernetType) *layers.Ethernet {
+	return &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 1, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 1, 2},
+		EthernetType: ethernetType,
+	}
+}
+
+func outerIPv4(protocol layers.IPProtocol) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, Protocol: protocol, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+}
+
+func (suite *DecoderTestSuite) TestDecodeTunnels() {
+	dnsFrame := suite.dnsPacket("mirrored.example.com", layers.DNSTypeA).Data()
+	dnsIP := dnsFrame[14:] // without the Ethernet header
+	geneveHeader := []byte{0x00, 0x00, 0x65, 0x58, 0x00, 0x00, 0x2a, 0x00}
+	erspanIIIHeader := []byte{0x20, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}
+	erspanIIIWithSubheader := append([]byte{0x20, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 1}, make([]byte, 8)...)
+
+	testCases := []struct {
+		name  string
+		inner []byte
+		outer []gopacket.SerializableLayer
+	}{
+		{
+			name:  "VXLAN",
+			inner: dnsFrame,
+			outer: []gopacket.SerializableLayer{outerEthernet(layers.EthernetTypeIPv4), outerIPv4(layers.IPProtocolUDP),
+				&layers.UDP{SrcPort: 50000, DstPort: 4789}, &layers.VXLAN{ValidIDFlag: true, VNI: 42}},
+		},
+		{
+			name:  "GENEVE",
+			inner: append(append([]byte(nil), geneveHeader...), dnsFrame...),
+			outer: []gopacket.SerializableLayer{outerEthernet(layers.EthernetTypeIPv4), outerIPv4(layers.IPProtocolUDP),
+				&layers.UDP{SrcPort: 50000, DstPort: 6081}},
+		},
+		{
+			name:  "GRE",
+			inner: dnsIP,
+			outer: []gopacket.SerializableLayer{outerEthernet(layers.EthernetTypeIPv4), outerIPv4(layers.IPProtocolGRE),
+				&layers.GRE{Protocol: layers.EthernetTypeIPv4}},
+		},
+		{
+			name:  "ERSPAN type II",
+			inner: dnsFrame,
+			outer: []gopacket.SerializableLayer{outerEthernet(layers.EthernetTypeIPv4), outerIPv4(layers.IPProtocolGRE),
+				&layers.GRE{Protocol: layers.EthernetTypeERSPAN, SeqPresent: true, Seq: 1}, &layers.ERSPANII{Version: 1, SessionID: 1}},
+		},
+		{
+			name:  "ERSPAN type III",
+			inner: append(append([]byte(nil), erspanIIIHeader...), dnsFrame...),
+			outer: []gopacket.SerializableLayer{outerEthernet(layers.EthernetTypeIPv4), outerIPv4(layers.IPProtocolGRE),
+				&layers.GRE{Protocol: greProtocolERSPANIII, SeqPresent: true, Seq: 1}},
+		},
+		{
+			name:  "ERSPAN type III with platform subheader",
+			inner: append(append([]byte(nil), erspanIIIWithSubheader...), dnsFrame...),
+			outer: []gopacket.SerializableLayer{outerEthernet(layers.EthernetTypeIPv4), outerIPv4(layers.IPProtocolGRE),
+				&layers.GRE{Protocol: greProtocolERSPANIII, SeqPresent: true, Seq: 1}},
+		},
+		{
+			name:  "QinQ",
+			inner: dnsIP,
+			outer: []gopacket.SerializableLayer{outerEthernet(layers.EthernetTypeQinQ),
+				&layers.Dot1Q{VLANIdentifier: 100, Type: layers.EthernetTypeDot1Q},
+				&layers.Dot1Q{VLANIdentifier: 200, Type: layers.EthernetTypeIPv4}},
+		},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+			packet, err := encapsulate(tc.inner, tc.outer...)
+			suite.Require().NoError(err)
+
+			NewDecoder(suite.queue, suite.logger, Options{}).Decode(packet)
+			suite.Equal([]string{"mirrored.example.com"}, suite.queue.Get())
+		})
+	}
+}
+
+func (suite *DecoderTestSuite) TestDecodeQUICOverVXLAN() {
+	hello, err := quicClientHello("quic.example.com")
+	suite.Require().NoError(err)
+	datagram, err := sealInitial(quicVersion1, []byte{1, 2, 3, 4, 5, 6, 7, 8}, 0, encodeCryptoFrame(0, hello))
+	suite.Require().NoError(err)
+	quicPacket, err := buildPacket(&layers.UDP{SrcPort: 40000, DstPort: HTTPSPort}, gopacket.Payload(datagram))
+	suite.Require().NoError(err)
+
+	// The outer datagram goes to 4789, only the inner one is QUIC
+	packet, err := encapsulate(quicPacket.Data(), outerEthernet(layers.EthernetTypeIPv4), outerIPv4(layers.IPProtocolUDP),
+		&layers.UDP{SrcPort: 50000, DstPort: 4789}, &layers.VXLAN{ValidIDFlag: true, VNI: 42})
+	suite.Require().NoError(err)
+
+	NewDecoder(suite.queue, suite.logger, Options{SNI: true}).Decode(packet)
+	suite.Equal([]string{"quic.example.com"}, suite.queue.Get())
+}
+
+func (suite *DecoderTestSuite) TestErspanIIIPayload() {
+	_, ok := erspanIIIPayload(make([]byte, 11))
+	suite.False(ok)
+	_, ok = erspanIIIPayload([]byte{0x20, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0})
+	suite.False(ok)
+	payload, ok := erspanIIIPayload([]byte{0x20, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0xaa})
+	suite.True(ok)
+	suite.Equal([]byte{0xaa}, payload)
+}
@@ -0,0 +1,109 @@
+package pcap
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/packet"
+)
+
+const (
+	DefaultInterface     = "any"
+	DefaultSnapLen       = 1600
+	DefaultStatsInterval = time.Minute
+	// DNSFilter is the BPF expression used for DNS traffic.
+	DNSFilter = "port 53 and (udp or tcp)"
+	// SNIFilter matches TCP segments carrying data and QUIC long header packets sent to port 443.
+	// A ClientHello often spans several segments and only the first starts with a handshake record,
+	// so every segment with a payload is captured and the decoder keeps the ones of new connections.
+	SNIFilter = "(tcp dst port 443 and ((ip and ip[2:2] - ((ip[0] & 0x0f) << 2) - ((tcp[12:1] & 0xf0) >> 2) != 0) or " +
+		"(ip6 and ip6[4:2] - ((tcp[12:1] & 0xf0) >> 2) != 0))) or (udp dst port 443 and udp[8] & 0xc0 = 0xc0)"
+	// HTTPFilter matches TCP traffic to the usual plaintext HTTP and forward proxy ports.
+	HTTPFilter = "tcp dst port 80 or tcp dst port 3128 or tcp dst port 8080"
+	// LocalFilter matches mDNS, LLMNR and NetBIOS name service traffic.
+	LocalFilter = "udp port 5353 or udp port 5355 or udp port 137"
+	// TunnelFilter matches the carriers of mirrored traffic, see packet.TunnelFilter.
+	TunnelFilter = packet.TunnelFilter
+)
+
+// Config controls what the PCAP source captures and how.
+type Config struct {
+	// Interfaces to capture on, each with its own handle. Defaults to "any".
+	Interfaces []string
+	// BPF replaces the filter built from the options below when set.
+	BPF string
+	// SnapLen is the maximum number of bytes captured per packet, DefaultSnapLen if zero.
+	SnapLen int
+	// Promiscuous puts the interfaces into promiscuous mode.
+	Promiscuous bool
+	// BufferSize is the kernel capture buffer size in KiB, the libpcap default if zero.
+	BufferSize int
+	// Immediate delivers packets as soon as they arrive instead of batching them.
+	Immediate bool
+	// StatsInterval is how often capture and drop counters are logged, DefaultStatsInterval if zero.
+	StatsInterval time.Duration
+	// SNI enables hostname extraction from TLS ClientHello and QUIC Initial packets.
+	SNI bool
+	// HTTP enables hostname extraction from plaintext HTTP Host headers and proxy requests.
+	HTTP bool
+	// Local enables mDNS, LLMNR and NetBIOS-NS capture. Local names are counted and reported rather than submitted.
+	Local bool
+	// Ports are extra DNS ports to capture, e.g. 5053 for dnscrypt-proxy.
+	Ports []uint16
+	// Tunnels enables capture of encapsulated and VLAN tagged traffic, e.g. from SPAN ports and cloud mirroring.
+	Tunnels bool
+}
+
+// Filter returns the BPF expression matching everything the configuration asks for.
+func (c Config) Filter() string {
+	if c.BPF != "" {
+		return c.BPF
+	}
+	filters := []string{DNSFilter}
+	if c.SNI {
+		filters = append(filters, SNIFilter)
+	}
+	if c.HTTP {
+		filters = append(filters, HTTPFilter)
+	}
+	if c.Local {
+		filters = append(filters, LocalFilter)
+	}
+	for _, port := range c.Ports {
+		filters = append(filters, "port "+strconv.Itoa(int(port))+" and (udp or tcp)")
+	}
+	filter := DNSFilter
+	if len(filters) > 1 {
+		filter = "(" + strings.Join(filters, ") or (") + ")"
+	}
+	if c.Tunnels {
+		filter = packet.TunnelBPF(filter)
+	}
+	return filter
+}
+
+func (c Config) interfaces() []string {
+	if len(c.Interfaces) == 0 {
+		return []string{DefaultInterface}
+	}
+	return c.Interfaces
+}
+
+func (c Config) snapLen() int {
+	if c.SnapLen <= 0 {
+		return DefaultSnapLen
+	}
+	return c.SnapLen
+}
+
+func (c Config) statsInterval() time.Duration {
+	if c.StatsInterval <= 0 {
+		return DefaultStatsInterval
+	}
+	return c.StatsInterval
+}
+
+func (c Config) decoderOptions() packet.Options {
+	return packet.Options{SNI: c.SNI, HTTP: c.HTTP, Local: c.Local, Ports: c.Ports}
+}
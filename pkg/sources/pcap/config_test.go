@@ -0,0 +1,68 @@
+package pcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ConfigTestSuite) TestFilter() {
+	testCases := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{
+			name:     "DNS only",
+			config:   Config{},
+			expected: DNSFilter,
+		},
+		{
+			name:     "SNI and HTTP",
+			config:   Config{SNI: true, HTTP: true},
+			expected: "(" + DNSFilter + ") or (" + SNIFilter + ") or (" + HTTPFilter + ")",
+		},
+		{
+			name:     "Local names and extra ports",
+			config:   Config{Local: true, Ports: []uint16{5053}},
+			expected: "(" + DNSFilter + ") or (" + LocalFilter + ") or (port 5053 and (udp or tcp))",
+		},
+		{
+			name:   "Tunnels",
+			config: Config{Tunnels: true},
+			expected: "(" + DNSFilter + ") or (" + TunnelFilter + ") or (vlan and ((" + DNSFilter + ") or (vlan and (" +
+				DNSFilter + "))))",
+		},
+		{
+			name:     "Custom BPF wins",
+			config:   Config{BPF: "udp port 5353", SNI: true, Tunnels: true},
+			expected: "udp port 5353",
+		},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			suite.Equal(tc.expected, tc.config.Filter())
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestDefaults() {
+	suite.Equal([]string{DefaultInterface}, Config{}.interfaces())
+	suite.Equal(DefaultSnapLen, Config{}.snapLen())
+	suite.Equal(DefaultStatsInterval, Config{}.statsInterval())
+
+	config := Config{Interfaces: []string{"eth0", "eth1"}, SnapLen: 9000, StatsInterval: time.Second}
+	suite.Equal([]string{"eth0", "eth1"}, config.interfaces())
+	suite.Equal(9000, config.snapLen())
+	suite.Equal(time.Second, config.statsInterval())
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
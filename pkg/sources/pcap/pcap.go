@@ -14,6 +14,7 @@ import (
 type PCAP struct {
 	queue  *models.DomainQueue
 	logger zerolog.Logger
+	config Config
 }
 
 // Stop is a placeholder for the actual implementation of stopping the PCAP source.
@@ -26,9 +27,10 @@ func (p *PCAP) Start() error {
 	return errors.New("PCAP source is not supported on this platform")
 }
 
-func NewPCAP(queue *models.DomainQueue, logger zerolog.Logger) sources.Source {
+func NewPCAP(queue *models.DomainQueue, logger zerolog.Logger, config Config) sources.Source {
 	return &PCAP{
 		queue:  queue,
 		logger: logger,
+		config: config,
 	}
 }
@@ -4,68 +4,172 @@ package pcap
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/rs/zerolog"
 	"github.com/tb0hdan/pdns-sensor/pkg/models"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources"
-	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/packet"
+)
+
+const (
+	// readTimeout lets blocked reads return, so that buffered packets are delivered
+	// without immediate mode and Stop can close the handles.
+	readTimeout = 500 * time.Millisecond
 )
 
 type PCAP struct {
-	queue  *models.DomainQueue
-	logger zerolog.Logger
+	queue   *models.DomainQueue
+	logger  zerolog.Logger
+	config  Config
+	handles map[string]*pcap.Handle
+	decoder *packet.Decoder
+	done    chan struct{}
+	lock    sync.Mutex
 }
 
-// Stop is a placeholder for the actual implementation of stopping the PCAP source.
 func (p *PCAP) Stop(ctx context.Context) error {
 	p.logger.Info().Msg("Stopping PCAP source...")
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.done == nil {
+		return nil
+	}
+	close(p.done)
+	p.done = nil
+	p.logStats()
+	for _, handle := range p.handles {
+		handle.Close()
+	}
+	p.handles = nil
 	return nil
 }
 
-
-func NewPCAP(queue *models.DomainQueue, logger zerolog.Logger) sources.Source {
+func NewPCAP(queue *models.DomainQueue, logger zerolog.Logger, config Config) sources.Source {
 	return &PCAP{
 		queue:  queue,
 		logger: logger,
+		config: config,
 	}
 }
 
 func (p *PCAP) Start() error {
-	// Open the device for capturing
-	handle, err := pcap.OpenLive("any", 1600, true, pcap.BlockForever)
+	handles := make(map[string]*pcap.Handle)
+	for _, iface := range p.config.interfaces() {
+		handle, err := p.open(iface)
+		if err != nil {
+			for _, opened := range handles {
+				opened.Close()
+			}
+			return err
+		}
+		handles[iface] = handle
+	}
+	// One decoder is shared so that all interfaces feed the same queue and local name counters
+	decoder := packet.NewDecoder(p.queue, p.logger, p.config.decoderOptions())
+	done := make(chan struct{})
+	p.lock.Lock()
+	p.handles = handles
+	p.decoder = decoder
+	p.done = done
+	p.lock.Unlock()
+	go p.reportStats(done)
+
+	var wg sync.WaitGroup
+	for iface, handle := range handles {
+		p.logger.Info().Msgf("Capturing on %s with filter: %s", iface, p.config.Filter())
+		wg.Add(1)
+		go func(handle *pcap.Handle) {
+			defer wg.Done()
+			packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+			for {
+				select {
+				case pkt, ok := <-packetSource.Packets():
+					if !ok {
+						return
+					}
+					decoder.Decode(pkt)
+				case <-done:
+					return
+				}
+			}
+		}(handle)
+	}
+	wg.Wait()
+	return nil
+}
+
+// open creates and activates a capture handle for one interface.
+func (p *PCAP) open(iface string) (*pcap.Handle, error) {
+	inactive, err := pcap.NewInactiveHandle(iface)
 	if err != nil {
-		return fmt.Errorf("error opening device: %w", err)
+		return nil, fmt.Errorf("error opening device %s: %w", iface, err)
 	}
-	defer handle.Close()
+	defer inactive.CleanUp()
 
-	err = handle.SetBPFFilter("port 53 and (udp or tcp)")
+	err = errors.Join(
+		inactive.SetSnapLen(p.config.snapLen()),
+		inactive.SetPromisc(p.config.Promiscuous),
+		inactive.SetTimeout(readTimeout),
+		inactive.SetImmediateMode(p.config.Immediate),
+	)
+	if p.config.BufferSize > 0 {
+		err = errors.Join(err, inactive.SetBufferSize(p.config.BufferSize*1024))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error configuring device %s: %w", iface, err)
+	}
+	handle, err := inactive.Activate()
 	if err != nil {
-		return fmt.Errorf("error setting BPF filter: %w", err)
+		return nil, fmt.Errorf("error activating device %s: %w", iface, err)
+	}
+	if err := handle.SetBPFFilter(p.config.Filter()); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("error setting BPF filter on %s: %w", iface, err)
+	}
+	return handle, nil
+}
+
+func (p *PCAP) reportStats(done chan struct{}) {
+	ticker := time.NewTicker(p.config.statsInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.lock.Lock()
+			p.logStats()
+			p.lock.Unlock()
+		case <-done:
+			return
+		}
 	}
+}
 
-	// Use the handle as a packet source to process all packets
-	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-	for packet := range packetSource.Packets() {
-		dnsLayer := packet.Layer(layers.LayerTypeDNS)
-		if dnsLayer == nil {
+// logStats logs the libpcap counters of every handle, the lock must be held.
+func (p *PCAP) logStats() {
+	for iface, handle := range p.handles {
+		stats, err := handle.Stats()
+		if err != nil {
+			p.logger.Debug().Err(err).Msgf("Error getting capture statistics for %s", iface)
 			continue
 		}
-		dns, _ := dnsLayer.(*layers.DNS)
-		for _, question := range dns.Questions {
-			if question.Type != layers.DNSTypeA && question.Type != layers.DNSTypeAAAA {
-				continue // Skip non-A and non-AAAA DNS questions
-			}
-			field := string(question.Name)
-			if !utils.IsValidDomain(field) {
-				continue
-			}
-			p.queue.Add(field)
+		event := p.logger.Info()
+		if stats.PacketsDropped > 0 || stats.PacketsIfDropped > 0 {
+			event = p.logger.Warn()
 		}
-
+		event.Str("interface", iface).
+			Int("received", stats.PacketsReceived).
+			Int("dropped", stats.PacketsDropped).
+			Int("if_dropped", stats.PacketsIfDropped).
+			Msg("PCAP capture statistics")
+	}
+	if p.config.Local && p.decoder != nil {
+		stats := p.decoder.LocalNameStats()
+		p.logger.Info().Int("distinct", stats.Distinct).Uint64("total", stats.Total).Msg("PCAP local names seen")
 	}
-	return nil
 }
@@ -0,0 +1,43 @@
+//go:build unix
+
+package pipe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+func (suite *PipeTestSuite) TestStartReadsFIFO() {
+	path := filepath.Join(suite.T().TempDir(), "feed")
+	suite.Require().NoError(syscall.Mkfifo(path, 0o600))
+
+	source := NewPipe(suite.queue, suite.logger, path)
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Start()
+	}()
+
+	// Two writers one after another, the source must survive the first one going away
+	for _, name := range []string{"first.example.com", "second.example.com"} {
+		writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+		suite.Require().NoError(err)
+		_, err = writer.WriteString(name + "\n")
+		suite.Require().NoError(err)
+		suite.Require().NoError(writer.Close())
+	}
+	suite.Eventually(func() bool {
+		return suite.queue.Count() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.ElementsMatch([]string{"first.example.com", "second.example.com"}, suite.queue.Get())
+
+	suite.NoError(source.Stop(context.Background()))
+	select {
+	case err := <-done:
+		suite.NoError(err)
+	case <-time.After(5 * time.Second):
+		suite.Fail("source did not stop")
+	}
+}
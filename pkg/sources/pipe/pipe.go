@@ -0,0 +1,133 @@
+package pipe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+const (
+	// Stdin is the path that selects standard input.
+	Stdin = "-"
+	// MaxLineSize is the longest line accepted, JSON observations with many answers can get long.
+	MaxLineSize = 1024 * 1024
+)
+
+// ParseLine parses one line of an ad-hoc feed. A line is either a JSON observation, like
+// {"query":"example.com","answers":["www.example.com"]}, or plain text whose first field is taken
+// as the name, which covers domain lists, zone files and most grep output. Blank lines and
+// comments starting with # or ; are skipped.
+func ParseLine(line string) []types.Observation {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == ';' {
+		return nil
+	}
+	if line[0] == '{' {
+		var observation types.Observation
+		if err := json.Unmarshal([]byte(line), &observation); err != nil {
+			return nil
+		}
+		return []types.Observation{observation}
+	}
+	return []types.Observation{{Query: strings.ToLower(strings.Fields(line)[0])}}
+}
+
+// Pipe reads names from standard input or a named pipe.
+type Pipe struct {
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+	path   string
+	file   *os.File
+	lock   sync.Mutex
+}
+
+func (p *Pipe) Start() error {
+	p.logger.Info().Msgf("Starting pipe source on %s...", p.path)
+	file, err := p.open()
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	p.file = file
+	p.lock.Unlock()
+
+	err = p.read(file)
+	if err != nil && !p.stopped() {
+		return fmt.Errorf("error reading %s: %w", p.path, err)
+	}
+	return nil
+}
+
+func (p *Pipe) Stop(ctx context.Context) error {
+	p.logger.Info().Msg("Stopping pipe source...")
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.file == nil {
+		return nil
+	}
+	err := p.file.Close()
+	p.file = nil
+	return err
+}
+
+func (p *Pipe) stopped() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.file == nil
+}
+
+// open returns the input. A named pipe is opened for writing as well, so that it neither blocks until
+// the first writer shows up nor reaches EOF when a writer goes away, and several feeds can come one after another.
+func (p *Pipe) open() (*os.File, error) {
+	if p.path == Stdin || p.path == "" {
+		return os.Stdin, nil
+	}
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", p.path, err)
+	}
+	flag := os.O_RDONLY
+	if info.Mode()&os.ModeNamedPipe != 0 {
+		flag = os.O_RDWR
+	}
+	file, err := os.OpenFile(p.path, flag, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", p.path, err)
+	}
+	return file, nil
+}
+
+// read processes lines until the input ends.
+func (p *Pipe) read(input io.Reader) error {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	for scanner.Scan() {
+		p.Process(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Process parses a single line and adds every name to the queue.
+func (p *Pipe) Process(line string) {
+	for _, observation := range ParseLine(line) {
+		p.queue.AddObservation(observation)
+	}
+}
+
+func NewPipe(queue *models.DomainQueue, logger zerolog.Logger, path string) sources.Source {
+	return &Pipe{
+		queue:  queue,
+		logger: logger,
+		path:   path,
+	}
+}
@@ -0,0 +1,104 @@
+package pipe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+type PipeTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *PipeTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *PipeTestSuite) TestParseLine() {
+	testCases := []struct {
+		name     string
+		line     string
+		expected []types.Observation
+	}{
+		{name: "Plain domain", line: "Example.COM", expected: []types.Observation{{Query: "example.com"}}},
+		{name: "Zone file record", line: "www.example.org. 3600 IN A 192.0.2.1", expected: []types.Observation{{Query: "www.example.org."}}},
+		{
+			name:     "JSON observation",
+			line:     `{"query":"example.net","qtype":"CNAME","client":"192.0.2.7","answers":["cdn.example.net","192.0.2.8"]}`,
+			expected: []types.Observation{{Query: "example.net", QType: "CNAME", Client: "192.0.2.7", Answers: []string{"cdn.example.net", "192.0.2.8"}}},
+		},
+		{name: "Broken JSON", line: `{"query":`, expected: nil},
+		{name: "Hash comment", line: "# threat feed 2024-01-01", expected: nil},
+		{name: "Zone file comment", line: "; generated", expected: nil},
+		{name: "Blank", line: "   ", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			suite.Equal(tc.expected, ParseLine(tc.line))
+		})
+	}
+}
+
+func (suite *PipeTestSuite) TestStartReadsFile() {
+	path := filepath.Join(suite.T().TempDir(), "domains.txt")
+	content := "www.example.com\n# comment\nlocalhost\n" +
+		`{"query":"api.example.org","answers":["edge.example.net"]}` + "\nwww.example.com.\nпример.рф\n"
+	suite.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+
+	source := NewPipe(suite.queue, suite.logger, path)
+	suite.NoError(source.Start())
+	suite.ElementsMatch([]string{"www.example.com", "api.example.org", "edge.example.net", "xn--e1afmkfd.xn--p1ai"},
+		suite.queue.Get())
+	suite.NoError(source.Stop(context.Background()))
+}
+
+func (suite *PipeTestSuite) TestStartMissingFile() {
+	source := NewPipe(suite.queue, suite.logger, filepath.Join(suite.T().TempDir(), "missing"))
+	suite.Error(source.Start())
+	suite.NoError(source.Stop(context.Background()))
+}
+
+func (suite *PipeTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = NewPipe(suite.queue, suite.logger, Stdin)
+	suite.True(true, "Pipe source implements sources.Source interface")
+}
+
+func TestPipeTestSuite(t *testing.T) {
+	suite.Run(t, new(PipeTestSuite))
+}
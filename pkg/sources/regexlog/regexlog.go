@@ -0,0 +1,124 @@
+package regexlog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+const (
+	// Group names recognized in patterns. Only qname is mandatory, ts is accepted but not used yet.
+	GroupQName  = "qname"
+	GroupQType  = "qtype"
+	GroupClient = "client"
+	GroupTS     = "ts"
+)
+
+// grokPatterns are the building blocks available as %{NAME} or %{NAME:group}.
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"IP":                `(?:(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+)`,
+	"HOSTNAME":          `[0-9A-Za-z_](?:[0-9A-Za-z_-]{0,62})(?:\.[0-9A-Za-z_](?:[0-9A-Za-z_-]{0,62}))*\.?`,
+	"DNSTYPE":           `[A-Z][A-Z0-9]*`,
+	"SYSLOGTIMESTAMP":   `[A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// Compile turns a pattern into a regular expression. Grok references are expanded first,
+// so plain regular expressions with (?P<qname>...) groups and grok patterns can be mixed.
+func Compile(pattern string) (*regexp.Regexp, error) {
+	var expandErr error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(reference string) string {
+		parts := grokReference.FindStringSubmatch(reference)
+		body, ok := grokPatterns[parts[1]]
+		if !ok {
+			expandErr = fmt.Errorf("unknown grok pattern: %s", parts[1])
+			return reference
+		}
+		if parts[2] == "" {
+			return "(?:" + body + ")"
+		}
+		return "(?P<" + parts[2] + ">" + body + ")"
+	})
+	if expandErr != nil {
+		return nil, expandErr
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling pattern: %w", err)
+	}
+	if re.SubexpIndex(GroupQName) < 0 {
+		return nil, errors.New("pattern must contain a qname group")
+	}
+	return re, nil
+}
+
+// Parser extracts observations from lines matching a configured pattern.
+type Parser struct {
+	re     *regexp.Regexp
+	filter string
+	qname  int
+	qtype  int
+	client int
+}
+
+func (p *Parser) ParseLine(line string) []types.Observation {
+	// Skip the regular expression for lines that can't match, the same way Mikrotik looks for "query from"
+	if p.filter != "" && !strings.Contains(line, p.filter) {
+		return nil
+	}
+	match := p.re.FindStringSubmatch(line)
+	if match == nil || match[p.qname] == "" {
+		return nil
+	}
+	return []types.Observation{{
+		Query:  match[p.qname],
+		QType:  group(match, p.qtype),
+		Client: group(match, p.client),
+	}}
+}
+
+func group(match []string, idx int) string {
+	if idx < 0 {
+		return ""
+	}
+	return match[idx]
+}
+
+func NewParser(pattern, filter string) (*Parser, error) {
+	re, err := Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{
+		re:     re,
+		filter: filter,
+		qname:  re.SubexpIndex(GroupQName),
+		qtype:  re.SubexpIndex(GroupQType),
+		client: re.SubexpIndex(GroupClient),
+	}, nil
+}
+
+func NewRegexLog(queue *models.DomainQueue, logger zerolog.Logger, logFile, pattern, filter string) (sources.Source, error) {
+	parser, err := NewParser(pattern, filter)
+	if err != nil {
+		return nil, err
+	}
+	return logtail.NewLogTail(queue, logger, "regex", logFile, parser.ParseLine), nil
+}
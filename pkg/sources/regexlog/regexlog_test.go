@@ -0,0 +1,114 @@
+package regexlog
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+type RegexLogTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *RegexLogTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *RegexLogTestSuite) TestNewRegexLog() {
+	source, err := NewRegexLog(suite.queue, suite.logger, "/var/log/dns.log", `query (?P<qname>\S+)`, "")
+	suite.NoError(err)
+
+	_, ok := source.(*logtail.LogTail)
+	suite.True(ok)
+}
+
+func (suite *RegexLogTestSuite) TestCompileErrors() {
+	testCases := []struct {
+		name    string
+		pattern string
+	}{
+		{name: "Missing qname group", pattern: `query (?P<name>\S+)`},
+		{name: "Unknown grok pattern", pattern: `%{NOPE:qname}`},
+		{name: "Broken regex", pattern: `(?P<qname>[a-z`},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			_, err := Compile(tc.pattern)
+			suite.Error(err)
+		})
+	}
+}
+
+func (suite *RegexLogTestSuite) TestParseLineRegex() {
+	parser, err := NewParser(`(?P<ts>\S+) client (?P<client>\S+)#\d+ .*query: (?P<qname>\S+) IN (?P<qtype>\S+)`, "query:")
+	suite.NoError(err)
+
+	line := "2024-01-01T12:00:00Z client 192.168.1.10#53211 (example.com): query: example.com IN AAAA +E(0)K (127.0.0.1)"
+	suite.Equal([]types.Observation{{Query: "example.com", QType: "AAAA", Client: "192.168.1.10"}}, parser.ParseLine(line))
+	suite.Nil(parser.ParseLine("2024-01-01T12:00:00Z client 192.168.1.10#53211: lame-server resolving example.com"))
+}
+
+func (suite *RegexLogTestSuite) TestParseLineGrok() {
+	parser, err := NewParser(`%{SYSLOGTIMESTAMP:ts} %{NOTSPACE} unbound\[%{INT}\]: info: %{IP:client} %{HOSTNAME:qname} %{DNSTYPE:qtype} IN`, "")
+	suite.NoError(err)
+
+	line := "Jan  1 12:00:00 gw unbound[1234]: info: 2001:db8::10 www.example.org. A IN"
+	suite.Equal([]types.Observation{{Query: "www.example.org.", QType: "A", Client: "2001:db8::10"}}, parser.ParseLine(line))
+}
+
+func (suite *RegexLogTestSuite) TestParseLineFilter() {
+	parser, err := NewParser(`: (?P<qname>\S+)`, "query from")
+	suite.NoError(err)
+
+	suite.Nil(parser.ParseLine("response to 192.168.1.1: example.com"))
+	suite.Equal([]types.Observation{{Query: "example.com."}}, parser.ParseLine("query from 192.168.1.1: example.com."))
+}
+
+func (suite *RegexLogTestSuite) TestProcessAddsDomains() {
+	source, err := NewRegexLog(suite.queue, suite.logger, "/var/log/dns.log", `query %{HOSTNAME:qname}`, "")
+	suite.NoError(err)
+	logTail := source.(*logtail.LogTail)
+	logTail.Process("query www.example.com.")
+	logTail.Process("query printer.local")
+	logTail.Process("reply www.example.net")
+
+	suite.ElementsMatch([]string{"www.example.com"}, suite.queue.Get())
+}
+
+func TestRegexLogTestSuite(t *testing.T) {
+	suite.Run(t, new(RegexLogTestSuite))
+}
@@ -0,0 +1,269 @@
+package sshdump
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/packet"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	DefaultUser    = "root"
+	DefaultPort    = "22"
+	DefaultFilter  = "port 53"
+	DefaultCommand = "tcpdump -n -i any -U -w - " + DefaultFilter
+	DefaultTimeout = 10 * time.Second
+	MinBackoff     = time.Second
+	MaxBackoff     = time.Minute
+)
+
+// Config describes the remote hosts to capture on and how to log in to them.
+type Config struct {
+	// Targets are [user@]host[:port] entries, DefaultUser and DefaultPort fill in the blanks.
+	Targets []string
+	// KeyFile is the private key used for authentication, ~/.ssh/id_ed25519 if empty.
+	KeyFile string
+	// KnownHostsFile verifies the host keys, ~/.ssh/known_hosts if empty.
+	KnownHostsFile string
+	// Command is run on every target and must write a pcap stream to stdout, DefaultCommand if empty.
+	Command string
+	// Tunnels extends the filter of DefaultCommand to VLAN tagged and encapsulated traffic. A custom
+	// Command has to ask for that itself.
+	Tunnels bool
+}
+
+// command returns the command run on every target.
+func (c Config) command() (string, error) {
+	if c.Command != "" && c.Command != DefaultCommand {
+		if c.Tunnels {
+			return "", errors.New("tunnels only apply to the default SSH command, a custom one has to capture them in its own filter")
+		}
+		return c.Command, nil
+	}
+	if c.Tunnels {
+		return "tcpdump -n -i any -U -w - '" + packet.TunnelBPF(DefaultFilter) + "'", nil
+	}
+	return DefaultCommand, nil
+}
+
+type target struct {
+	user string
+	addr string
+}
+
+// parseTarget splits a [user@]host[:port] entry.
+func parseTarget(entry string) (target, error) {
+	t := target{user: DefaultUser}
+	host := strings.TrimSpace(entry)
+	if user, rest, found := strings.Cut(host, "@"); found {
+		t.user, host = user, rest
+	}
+	if host == "" || t.user == "" {
+		return target{}, fmt.Errorf("invalid SSH target %q", entry)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), DefaultPort)
+	}
+	t.addr = host
+	return t, nil
+}
+
+// SSHDump runs tcpdump on remote hosts over SSH and decodes the captures locally, so that one sensor
+// can cover routers and servers that can't run it themselves.
+type SSHDump struct {
+	queue      *models.DomainQueue
+	logger     zerolog.Logger
+	config     Config
+	targets    []target
+	signer     ssh.Signer
+	hostKey    ssh.HostKeyCallback
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	cancel     context.CancelFunc
+	lock       sync.Mutex
+}
+
+func (s *SSHDump) Start() error {
+	s.logger.Info().Msgf("Starting SSH capture source for %d target(s)...", len(s.targets))
+	if len(s.targets) == 0 {
+		return errors.New("no SSH targets configured")
+	}
+	signer, hostKey, err := s.credentials()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.lock.Lock()
+	s.cancel = cancel
+	s.signer = signer
+	s.hostKey = hostKey
+	s.lock.Unlock()
+
+	// One decoder is shared so that all targets feed the same queue
+	decoder := packet.NewDecoder(s.queue, s.logger, packet.Options{})
+	var wg sync.WaitGroup
+	for _, t := range s.targets {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			s.run(ctx, t, decoder)
+		}(t)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *SSHDump) Stop(ctx context.Context) error {
+	s.logger.Info().Msg("Stopping SSH capture source...")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return nil
+}
+
+func (s *SSHDump) credentials() (ssh.Signer, ssh.HostKeyCallback, error) {
+	keyFile, knownHostsFile := s.config.KeyFile, s.config.KnownHostsFile
+	if keyFile == "" || knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error finding home directory: %w", err)
+		}
+		if keyFile == "" {
+			keyFile = filepath.Join(home, ".ssh", "id_ed25519")
+		}
+		if knownHostsFile == "" {
+			knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing SSH key %s: %w", keyFile, err)
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading known hosts: %w", err)
+	}
+	return signer, hostKeyCallback, nil
+}
+
+// run captures on one target until ctx is done, reconnecting with exponential backoff.
+func (s *SSHDump) run(ctx context.Context, t target, decoder *packet.Decoder) {
+	backoff := s.minBackoff
+	for {
+		established, err := s.capture(ctx, t, decoder)
+		if ctx.Err() != nil {
+			return
+		}
+		if established {
+			backoff = s.minBackoff
+		}
+		s.logger.Warn().Err(err).Str("target", t.addr).Msgf("SSH capture ended, reconnecting in %s", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// capture runs the command on one target and decodes its output until either side stops.
+// established tells whether a capture was actually received, which resets the backoff.
+func (s *SSHDump) capture(ctx context.Context, t target, decoder *packet.Decoder) (established bool, err error) {
+	s.lock.Lock()
+	clientConfig := &ssh.ClientConfig{
+		User:            t.user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(s.signer)},
+		HostKeyCallback: s.hostKey,
+		Timeout:         DefaultTimeout,
+	}
+	s.lock.Unlock()
+	client, err := ssh.Dial("tcp", t.addr, clientConfig)
+	if err != nil {
+		return false, fmt.Errorf("error connecting: %w", err)
+	}
+	defer client.Close()
+	// Closing the client unblocks the reads below
+	stop := context.AfterFunc(ctx, func() { _ = client.Close() })
+	defer stop()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return false, fmt.Errorf("error opening session: %w", err)
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return false, fmt.Errorf("error creating StdoutPipe: %w", err)
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return false, fmt.Errorf("error creating StderrPipe: %w", err)
+	}
+	command := s.config.Command
+	if err := session.Start(command); err != nil {
+		return false, fmt.Errorf("error starting %q: %w", command, err)
+	}
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			s.logger.Info().Str("target", t.addr).Msgf("tcpdump: %s", scanner.Text())
+		}
+	}()
+	s.logger.Info().Str("target", t.addr).Msg("SSH capture started")
+
+	if err := decoder.DecodePcap(stdout); err != nil {
+		return false, err
+	}
+	if err := session.Wait(); err != nil {
+		return true, fmt.Errorf("command finished with error: %w", err)
+	}
+	return true, errors.New("command finished")
+}
+
+func NewSSHDump(queue *models.DomainQueue, logger zerolog.Logger, config Config) (sources.Source, error) {
+	targets := make([]target, 0, len(config.Targets))
+	for _, entry := range config.Targets {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		t, err := parseTarget(entry)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	command, err := config.command()
+	if err != nil {
+		return nil, err
+	}
+	config.Command = command
+	return &SSHDump{
+		queue:      queue,
+		logger:     logger,
+		config:     config,
+		targets:    targets,
+		minBackoff: MinBackoff,
+		maxBackoff: MaxBackoff,
+	}, nil
+}
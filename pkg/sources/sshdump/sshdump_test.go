@@ -0,0 +1,337 @@
+package sshdump
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/packet"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+// pcapStream builds a capture with a DNS query per name, as tcpdump -w - would write it.
+func pcapStream(names ...string) ([]byte, error) {
+	var stream bytes.Buffer
+	writer := pcapgo.NewWriter(&stream)
+	if err := writer.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		ethernet := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{192, 0, 2, 1}, DstIP: net.IP{192, 0, 2, 53}}
+		udp := &layers.UDP{SrcPort: 40000, DstPort: 53}
+		dns := &layers.DNS{Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}}
+		buffer := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true}, ethernet, ip, udp, dns); err != nil {
+			return nil, err
+		}
+		ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(buffer.Bytes()), Length: len(buffer.Bytes())}
+		if err := writer.WritePacket(ci, buffer.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return stream.Bytes(), nil
+}
+
+// sshServer is an in-process SSH server that answers every exec request with a canned capture.
+type sshServer struct {
+	listener    net.Listener
+	config      *ssh.ServerConfig
+	stream      []byte
+	connections atomic.Int32
+	commands    chan string
+}
+
+func newSSHServer(hostKey ssh.Signer, authorized ssh.PublicKey, stream []byte) (*sshServer, error) {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "sensor" && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &sshServer{listener: listener, config: config, stream: stream, commands: make(chan string, 100)}
+	go server.serve()
+	return server, nil
+}
+
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *sshServer) handle(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	s.connections.Add(1)
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for request := range channelRequests {
+				if request.Type != "exec" {
+					_ = request.Reply(false, nil)
+					continue
+				}
+				var exec struct{ Command string }
+				_ = ssh.Unmarshal(request.Payload, &exec)
+				s.commands <- exec.Command
+				_ = request.Reply(true, nil)
+				_, _ = channel.Write(s.stream)
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				_ = channel.Close()
+			}
+		}()
+	}
+}
+
+type SSHDumpTestSuite struct {
+	suite.Suite
+	queue      *models.DomainQueue
+	logger     zerolog.Logger
+	dir        string
+	hostKey    ssh.Signer
+	clientKey  ssh.Signer
+	keyFile    string
+	knownHosts string
+	server     *sshServer
+}
+
+func (suite *SSHDumpTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+	suite.dir = suite.T().TempDir()
+
+	_, hostPrivate, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	suite.hostKey, err = ssh.NewSignerFromKey(hostPrivate)
+	suite.Require().NoError(err)
+	_, clientPrivate, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	suite.clientKey, err = ssh.NewSignerFromKey(clientPrivate)
+	suite.Require().NoError(err)
+	block, err := ssh.MarshalPrivateKey(clientPrivate, "")
+	suite.Require().NoError(err)
+	suite.keyFile = filepath.Join(suite.dir, "id_ed25519")
+	suite.Require().NoError(os.WriteFile(suite.keyFile, pem.EncodeToMemory(block), 0o600))
+
+	stream, err := pcapStream("www.example.com", "remote.example.org")
+	suite.Require().NoError(err)
+	suite.server, err = newSSHServer(suite.hostKey, suite.clientKey.PublicKey(), stream)
+	suite.Require().NoError(err)
+	suite.knownHosts = suite.writeKnownHosts(suite.hostKey.PublicKey())
+}
+
+func (suite *SSHDumpTestSuite) TearDownTest() {
+	_ = suite.server.listener.Close()
+}
+
+func (suite *SSHDumpTestSuite) writeKnownHosts(key ssh.PublicKey) string {
+	path := filepath.Join(suite.dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(suite.server.listener.Addr().String())}, key)
+	suite.Require().NoError(os.WriteFile(path, []byte(line+"\n"), 0o600))
+	return path
+}
+
+func (suite *SSHDumpTestSuite) newSource(command string) *SSHDump {
+	source, err := NewSSHDump(suite.queue, suite.logger, Config{
+		Targets:        []string{"sensor@" + suite.server.listener.Addr().String()},
+		KeyFile:        suite.keyFile,
+		KnownHostsFile: suite.knownHosts,
+		Command:        command,
+	})
+	suite.Require().NoError(err)
+	sshDump := source.(*SSHDump)
+	sshDump.minBackoff = 10 * time.Millisecond
+	sshDump.maxBackoff = 20 * time.Millisecond
+	return sshDump
+}
+
+func (suite *SSHDumpTestSuite) TestCaptureAndReconnect() {
+	source := suite.newSource("")
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Start()
+	}()
+
+	suite.Equal(DefaultCommand, <-suite.server.commands)
+	// Every session ends after one capture, so the source has to reconnect
+	suite.Eventually(func() bool {
+		return suite.server.connections.Load() >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.ElementsMatch([]string{"www.example.com", "remote.example.org"}, suite.queue.Get())
+
+	suite.NoError(source.Stop(context.Background()))
+	select {
+	case err := <-done:
+		suite.NoError(err)
+	case <-time.After(5 * time.Second):
+		suite.Fail("source did not stop")
+	}
+}
+
+func (suite *SSHDumpTestSuite) TestHostKeyMismatch() {
+	_, otherPrivate, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	otherKey, err := ssh.NewSignerFromKey(otherPrivate)
+	suite.Require().NoError(err)
+	suite.knownHosts = suite.writeKnownHosts(otherKey.PublicKey())
+
+	source := suite.newSource("tcpdump -w - port 53")
+	source.signer, source.hostKey, err = source.credentials()
+	suite.Require().NoError(err)
+	decoder := packet.NewDecoder(suite.queue, suite.logger, packet.Options{})
+	established, err := source.capture(context.Background(), source.targets[0], decoder)
+	suite.False(established)
+	suite.Error(err)
+
+	var keyError *knownhosts.KeyError
+	suite.ErrorAs(err, &keyError)
+	suite.Equal(0, suite.queue.Count())
+	suite.Equal(int32(0), suite.server.connections.Load())
+}
+
+func (suite *SSHDumpTestSuite) TestCredentialErrors() {
+	source := suite.newSource("")
+	source.config.KeyFile = filepath.Join(suite.dir, "missing")
+	_, _, err := source.credentials()
+	suite.Error(err)
+
+	source = suite.newSource("")
+	source.config.KnownHostsFile = filepath.Join(suite.dir, "missing")
+	_, _, err = source.credentials()
+	suite.Error(err)
+}
+
+func (suite *SSHDumpTestSuite) TestParseTarget() {
+	testCases := []struct {
+		entry    string
+		expected target
+		err      bool
+	}{
+		{entry: "router.example.com", expected: target{user: DefaultUser, addr: "router.example.com:22"}},
+		{entry: "admin@192.0.2.1:2222", expected: target{user: "admin", addr: "192.0.2.1:2222"}},
+		{entry: "admin@[2001:db8::1]", expected: target{user: "admin", addr: "[2001:db8::1]:22"}},
+		{entry: "@router", err: true},
+		{entry: "admin@", err: true},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.entry, func() {
+			result, err := parseTarget(tc.entry)
+			if tc.err {
+				suite.Error(err)
+				return
+			}
+			suite.NoError(err)
+			suite.Equal(tc.expected, result)
+		})
+	}
+}
+
+func (suite *SSHDumpTestSuite) TestNewSSHDump() {
+	_, err := NewSSHDump(suite.queue, suite.logger, Config{Targets: []string{"@bad"}})
+	suite.Error(err)
+
+	source, err := NewSSHDump(suite.queue, suite.logger, Config{Targets: []string{"", " "}})
+	suite.Require().NoError(err)
+	suite.Error(source.Start())
+}
+
+func (suite *SSHDumpTestSuite) TestCommand() {
+	for _, tc := range []struct {
+		config   Config
+		expected string
+	}{
+		{Config{}, DefaultCommand},
+		{Config{Command: DefaultCommand}, DefaultCommand},
+		{Config{Command: "sudo tcpdump -w - port 53"}, "sudo tcpdump -w - port 53"},
+		{Config{Tunnels: true}, "tcpdump -n -i any -U -w - '" + packet.TunnelBPF(DefaultFilter) + "'"},
+		{Config{Command: DefaultCommand, Tunnels: true}, "tcpdump -n -i any -U -w - '" + packet.TunnelBPF(DefaultFilter) + "'"},
+	} {
+		command, err := tc.config.command()
+		suite.NoError(err)
+		suite.Equal(tc.expected, command)
+	}
+	_, err := NewSSHDump(suite.queue, suite.logger, Config{Command: "sudo tcpdump -w - port 53", Tunnels: true})
+	suite.Error(err)
+}
+
+func (suite *SSHDumpTestSuite) TestInterfaceCompliance() {
+	source, err := NewSSHDump(suite.queue, suite.logger, Config{})
+	suite.Require().NoError(err)
+	var _ sources.Source = source
+	suite.True(true, "SSH capture source implements sources.Source interface")
+}
+
+func TestSSHDumpTestSuite(t *testing.T) {
+	suite.Run(t, new(SSHDumpTestSuite))
+}
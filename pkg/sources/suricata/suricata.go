@@ -0,0 +1,116 @@
+package suricata
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+const (
+	DefaultLogFile = "/var/log/suricata/eve.json"
+)
+
+type resourceRecord struct {
+	RRName string `json:"rrname"`
+	RRType string `json:"rrtype"`
+	RData  string `json:"rdata"`
+}
+
+// dnsRecord covers the v1 (one line per answer), v2 (answers array) and v3 (queries array) layouts.
+type dnsRecord struct {
+	Type    string           `json:"type"`
+	RRName  string           `json:"rrname"`
+	RRType  string           `json:"rrtype"`
+	RCode   string           `json:"rcode"`
+	RData   string           `json:"rdata"`
+	Queries []resourceRecord `json:"queries"`
+	Answers []resourceRecord `json:"answers"`
+}
+
+type eveRecord struct {
+	EventType string     `json:"event_type"`
+	SrcIP     string     `json:"src_ip"`
+	DestIP    string     `json:"dest_ip"`
+	DNS       *dnsRecord `json:"dns"`
+}
+
+// hostTypes are the record types whose rdata is a single host name.
+var hostTypes = map[string]bool{
+	"CNAME": true,
+	"DNAME": true,
+	"MX":    true,
+	"NS":    true,
+	"PTR":   true,
+}
+
+// ParseLine parses a single eve.json line, ignoring everything but dns events.
+func ParseLine(line string) []types.Observation {
+	// Cheap prefilter, eve.json is dominated by flow and alert events
+	if !strings.Contains(line, `"dns"`) {
+		return nil
+	}
+	var record eveRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return nil
+	}
+	if record.EventType != "dns" || record.DNS == nil {
+		return nil
+	}
+	dns := record.DNS
+	// Queries travel client -> server, answers server -> client
+	client := record.SrcIP
+	if dns.Type == "answer" || dns.Type == "response" {
+		client = record.DestIP
+	}
+
+	questions := dns.Queries
+	if len(questions) == 0 && dns.RRName != "" {
+		questions = []resourceRecord{{RRName: dns.RRName, RRType: dns.RRType}}
+	}
+	answers := dns.Answers
+	if len(answers) == 0 && dns.RData != "" {
+		answers = []resourceRecord{{RRName: dns.RRName, RRType: dns.RRType, RData: dns.RData}}
+	}
+
+	observations := make([]types.Observation, 0, len(questions))
+	for _, question := range questions {
+		observations = append(observations, types.Observation{
+			Query:   question.RRName,
+			QType:   question.RRType,
+			RCode:   dns.RCode,
+			Client:  client,
+			Answers: answerData(answers),
+		})
+	}
+	return observations
+}
+
+// answerData returns the owner names of all answers plus rdata of address and host name records.
+func answerData(answers []resourceRecord) []string {
+	var result []string
+	seen := make(map[string]bool)
+	add := func(value string) {
+		if value == "" || seen[value] {
+			return
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	for _, answer := range answers {
+		add(answer.RRName)
+		if (hostTypes[answer.RRType] || answer.RRType == "A" || answer.RRType == "AAAA") &&
+			!strings.Contains(answer.RData, " ") {
+			add(answer.RData)
+		}
+	}
+	return result
+}
+
+func NewSuricataLog(queue *models.DomainQueue, logger zerolog.Logger, logFile string) sources.Source {
+	return logtail.NewLogTail(queue, logger, "Suricata", logFile, ParseLine)
+}
@@ -0,0 +1,140 @@
+package suricata
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+type SuricataTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *SuricataTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *SuricataTestSuite) TestNewSuricataLog() {
+	source := NewSuricataLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.NotNil(source)
+
+	_, ok := source.(*logtail.LogTail)
+	suite.True(ok)
+}
+
+func (suite *SuricataTestSuite) TestParseLine() {
+	testCases := []struct {
+		name     string
+		line     string
+		expected []types.Observation
+	}{
+		{
+			name: "v1 query",
+			line: `{"timestamp":"2024-01-01T12:00:00.000000+0000","event_type":"dns","src_ip":"192.168.1.10",` +
+				`"dest_ip":"8.8.8.8","proto":"UDP","dns":{"type":"query","id":1234,"rrname":"example.com","rrtype":"A","tx_id":0}}`,
+			expected: []types.Observation{{Query: "example.com", QType: "A", Client: "192.168.1.10"}},
+		},
+		{
+			name: "v1 answer",
+			line: `{"event_type":"dns","src_ip":"8.8.8.8","dest_ip":"192.168.1.10",` +
+				`"dns":{"type":"answer","id":1234,"rcode":"NOERROR","rrname":"www.example.com","rrtype":"CNAME","ttl":60,"rdata":"cdn.example.net"}}`,
+			expected: []types.Observation{{
+				Query:   "www.example.com",
+				QType:   "CNAME",
+				RCode:   "NOERROR",
+				Client:  "192.168.1.10",
+				Answers: []string{"www.example.com", "cdn.example.net"},
+			}},
+		},
+		{
+			name: "v2 answer",
+			line: `{"event_type":"dns","src_ip":"8.8.8.8","dest_ip":"192.168.1.10","dns":{"version":2,"type":"answer",` +
+				`"id":1234,"rrname":"www.example.org","rrtype":"A","rcode":"NOERROR","answers":[` +
+				`{"rrname":"www.example.org","rrtype":"CNAME","ttl":60,"rdata":"edge.example.net"},` +
+				`{"rrname":"edge.example.net","rrtype":"A","ttl":60,"rdata":"192.0.2.1"},` +
+				`{"rrname":"www.example.org","rrtype":"TXT","ttl":60,"rdata":"hello world"}]}}`,
+			expected: []types.Observation{{
+				Query:   "www.example.org",
+				QType:   "A",
+				RCode:   "NOERROR",
+				Client:  "192.168.1.10",
+				Answers: []string{"www.example.org", "edge.example.net", "192.0.2.1"},
+			}},
+		},
+		{
+			name: "v3 request",
+			line: `{"event_type":"dns","src_ip":"192.168.1.10","dest_ip":"8.8.8.8","dns":{"version":3,"type":"request",` +
+				`"id":1234,"queries":[{"rrname":"example.net","rrtype":"AAAA"}]}}`,
+			expected: []types.Observation{{Query: "example.net", QType: "AAAA", Client: "192.168.1.10"}},
+		},
+		{
+			name:     "Non-dns event",
+			line:     `{"event_type":"flow","src_ip":"192.168.1.10","dest_ip":"8.8.8.8","app_proto":"dns"}`,
+			expected: nil,
+		},
+		{
+			name:     "Broken json",
+			line:     `{"event_type":"dns","dns":`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		suite.Run(tc.name, func() {
+			suite.Equal(tc.expected, ParseLine(tc.line))
+		})
+	}
+}
+
+func (suite *SuricataTestSuite) TestProcessAddsDomains() {
+	source := NewSuricataLog(suite.queue, suite.logger, DefaultLogFile).(*logtail.LogTail)
+	source.Process(`{"event_type":"dns","src_ip":"8.8.8.8","dest_ip":"192.168.1.10","dns":{"version":2,"type":"answer",` +
+		`"rrname":"www.example.org","rrtype":"A","rcode":"NOERROR","answers":[` +
+		`{"rrname":"www.example.org","rrtype":"CNAME","rdata":"edge.example.net"},` +
+		`{"rrname":"edge.example.net","rrtype":"A","rdata":"192.0.2.1"}]}}`)
+
+	suite.ElementsMatch([]string{"www.example.org", "edge.example.net"}, suite.queue.Get())
+}
+
+func (suite *SuricataTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = NewSuricataLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.True(true, "Suricata log source implements sources.Source interface")
+}
+
+func TestSuricataTestSuite(t *testing.T) {
+	suite.Run(t, new(SuricataTestSuite))
+}
@@ -0,0 +1,64 @@
+package tcpdump
+
+import (
+	"strconv"
+
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/packet"
+)
+
+const (
+	DefaultInterface = "any"
+	DefaultFilter    = "port 53"
+)
+
+// Config controls the capture options passed to tcpdump.
+type Config struct {
+	// Interfaces to capture on, one tcpdump process each. Defaults to "any".
+	Interfaces []string
+	// BPF is the capture filter, DefaultFilter if empty.
+	BPF string
+	// SnapLen is the maximum number of bytes captured per packet, the tcpdump default if zero.
+	SnapLen int
+	// Promiscuous puts the interfaces into promiscuous mode, tcpdump is run with -p otherwise.
+	Promiscuous bool
+	// BufferSize is the kernel capture buffer size in KiB, the tcpdump default if zero.
+	BufferSize int
+	// Immediate delivers packets as soon as they arrive instead of batching them in the kernel.
+	Immediate bool
+	// Tunnels extends the filter to VLAN tagged and encapsulated traffic, e.g. from SPAN ports and cloud mirroring.
+	Tunnels bool
+}
+
+// Args returns the tcpdump command line for capturing on iface. The capture is written to stdout
+// in pcap format rather than printed, so that it can be decoded exactly. It's packet buffered,
+// or packets would wait in the pipe until tcpdump fills its output buffer.
+func (c Config) Args(iface string) []string {
+	args := []string{"-n", "-i", iface, "-U", "-w", "-"}
+	if !c.Promiscuous {
+		args = append(args, "-p")
+	}
+	if c.SnapLen > 0 {
+		args = append(args, "-s", strconv.Itoa(c.SnapLen))
+	}
+	if c.BufferSize > 0 {
+		args = append(args, "-B", strconv.Itoa(c.BufferSize))
+	}
+	if c.Immediate {
+		args = append(args, "--immediate-mode")
+	}
+	filter := c.BPF
+	if filter == "" {
+		filter = DefaultFilter
+	}
+	if c.Tunnels {
+		filter = packet.TunnelBPF(filter)
+	}
+	return append(args, filter)
+}
+
+func (c Config) interfaces() []string {
+	if len(c.Interfaces) == 0 {
+		return []string{DefaultInterface}
+	}
+	return c.Interfaces
+}
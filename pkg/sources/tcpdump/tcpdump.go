@@ -3,80 +3,134 @@ package tcpdump
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/tb0hdan/pdns-sensor/pkg/models"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources"
-	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/packet"
+)
+
+const (
+	// StopTimeout is how long tcpdump gets to print its counters and exit after Stop before it's killed.
+	StopTimeout = 5 * time.Second
 )
 
 type TCPDump struct {
-	queue  *models.DomainQueue
-	logger zerolog.Logger
+	queue    *models.DomainQueue
+	logger   zerolog.Logger
+	config   Config
+	cancel   context.CancelFunc
+	captures sync.WaitGroup
+	lock     sync.Mutex
 }
 
-// Stop is a placeholder for the actual implementation of stopping the TCPDump source.
+// Stop interrupts the tcpdump processes and waits for them to exit, or for ctx to be done.
 func (t *TCPDump) Stop(ctx context.Context) error {
 	t.logger.Info().Msg("Stopping TCPDump source...")
-	return nil
+	t.lock.Lock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.captures.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (t *TCPDump) Start() error {
-	args := []string{"-ni", "any", "port", "53"}
-	cmd := exec.Command("tcpdump", args...)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.lock.Lock()
+	t.cancel = cancel
+	t.lock.Unlock()
+
+	interfaces := t.config.interfaces()
+	decoder := packet.NewDecoder(t.queue, t.logger, packet.Options{})
+	errs := make(chan error, len(interfaces))
+	t.captures.Add(len(interfaces))
+	for _, iface := range interfaces {
+		go func(iface string) {
+			defer t.captures.Done()
+			errs <- t.capture(ctx, iface, decoder)
+		}(iface)
+	}
+	var result error
+	for range interfaces {
+		if err := <-errs; err != nil {
+			result = errors.Join(result, err)
+		}
+	}
+	return result
+}
+
+// capture runs one tcpdump process for iface until it exits, or until ctx is done.
+func (t *TCPDump) capture(ctx context.Context, iface string, decoder *packet.Decoder) error {
+	cmd := exec.CommandContext(ctx, "tcpdump", t.config.Args(iface)...)
+	// Interrupt rather than kill, so tcpdump still reports its counters
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = StopTimeout
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		t.logger.Fatal().Msgf("Error creating StdoutPipe: %v", err)
+		return fmt.Errorf("error creating StdoutPipe: %w", err)
+	}
+	// tcpdump reports its capture and drop counters on stderr when it exits
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("error creating StderrPipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		t.logger.Fatal().Msgf("Error starting command: %v", err)
+		return fmt.Errorf("error starting command: %w", err)
 	}
-	// We're good to continue, now we can read from stdout
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		// Filter non-empty lines that don't contain "IP"
-		if !strings.Contains(line, "IP") {
-			continue
-		}
-		// Filter lines that do not contain "A?" or "AAAA?"
-		if !strings.Contains(line, "A?") && !strings.Contains(line, "AAAA?") {
-			continue
-		}
-		for _, field := range strings.Fields(line) {
-			if !strings.HasSuffix(field, ".") {
-				continue
-			}
-			field = strings.TrimSuffix(field, ".")
-			if !utils.IsValidDomain(field) {
-				continue
-			}
-			t.queue.Add(field)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			t.logger.Info().Str("interface", iface).Msgf("tcpdump: %s", scanner.Text())
 		}
+	}()
+	// We're good to continue, now we can decode the capture written to stdout
+	decodeErr := decoder.DecodePcap(stdout)
+	if decodeErr != nil {
+		// Don't leave tcpdump blocked on a pipe nobody reads
+		_ = cmd.Process.Kill()
 	}
-
-	if err := scanner.Err(); err != nil {
-		t.logger.Fatal().Msgf("Error reading stdout: %v", err)
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		t.logger.Info().Msgf("Subprocess for %s stopped.", iface)
+		return nil
 	}
-
-	if err := cmd.Wait(); err != nil {
-		t.logger.Fatal().Msgf("Command finished with error: %v", err)
+	if err != nil {
+		return errors.Join(decodeErr, fmt.Errorf("command finished with error: %w", err))
+	}
+	if decodeErr != nil {
+		return decodeErr
 	}
 
-	t.logger.Info().Msg("Subprocess finished successfully.")
+	t.logger.Info().Msgf("Subprocess for %s finished successfully.", iface)
 	return nil
 }
 
-func NewTCPDump(queue *models.DomainQueue, logger zerolog.Logger) sources.Source {
+func NewTCPDump(queue *models.DomainQueue, logger zerolog.Logger, config Config) sources.Source {
 	return &TCPDump{
 		queue:  queue,
 		logger: logger,
+		config: config,
 	}
 }
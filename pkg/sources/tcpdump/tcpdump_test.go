@@ -4,15 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/suite"
 	"github.com/tb0hdan/pdns-sensor/pkg/models"
 	"github.com/tb0hdan/pdns-sensor/pkg/sources"
-	"github.com/tb0hdan/pdns-sensor/pkg/utils"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/packet"
 )
 
 type MockCache struct {
@@ -61,7 +62,7 @@ func (suite *TCPDumpTestSuite) TestNewTCPDump() {
 	cache := NewMockCache()
 	queue := models.NewDomainQueue(cache, 3600)
 	
-	source := NewTCPDump(queue, logger)
+	source := NewTCPDump(queue, logger, Config{})
 	suite.NotNil(source)
 	
 	tcpdump, ok := source.(*TCPDump)
@@ -69,85 +70,69 @@ func (suite *TCPDumpTestSuite) TestNewTCPDump() {
 	suite.Equal(queue, tcpdump.queue)
 }
 
-func (suite *TCPDumpTestSuite) TestStop() {
-	ctx := context.Background()
-	err := suite.tcpdump.Stop(ctx)
-	suite.NoError(err)
-}
-
-func (suite *TCPDumpTestSuite) TestParseTCPDumpLine() {
+func (suite *TCPDumpTestSuite) TestConfigArgs() {
 	testCases := []struct {
-		name           string
-		line           string
-		expectedDomain string
-		shouldAdd      bool
+		name     string
+		config   Config
+		expected []string
 	}{
 		{
-			name:           "Valid A query",
-			line:           "15:30:45.123456 IP 192.168.1.1.54321 > 8.8.8.8.53: 12345+ A? example.com. (29)",
-			expectedDomain: "example.com",
-			shouldAdd:      true,
-		},
-		{
-			name:           "Valid AAAA query",
-			line:           "15:30:45.123456 IP 192.168.1.1.54321 > 8.8.8.8.53: 12345+ AAAA? test.example.org. (29)",
-			expectedDomain: "test.example.org",
-			shouldAdd:      true,
-		},
-		{
-			name:           "Non-A/AAAA query",
-			line:           "15:30:45.123456 IP 192.168.1.1.54321 > 8.8.8.8.53: 12345+ MX? example.com. (29)",
-			expectedDomain: "",
-			shouldAdd:      false,
+			name:     "Defaults",
+			config:   Config{Promiscuous: true},
+			expected: []string{"-n", "-i", "eth0", "-U", "-w", "-", "port 53"},
 		},
 		{
-			name:           "Line without IP",
-			line:           "15:30:45.123456 ARP, Request who-has 192.168.1.1 tell 192.168.1.2",
-			expectedDomain: "",
-			shouldAdd:      false,
+			name:   "All options",
+			config: Config{BPF: "udp port 53 or udp port 5353", SnapLen: 512, BufferSize: 8192, Immediate: true},
+			expected: []string{"-n", "-i", "eth0", "-U", "-w", "-", "-p", "-s", "512", "-B", "8192", "--immediate-mode",
+				"udp port 53 or udp port 5353"},
 		},
 		{
-			name:           "Empty line",
-			line:           "",
-			expectedDomain: "",
-			shouldAdd:      false,
-		},
-		{
-			name:           "Multiple domains in line",
-			line:           "15:30:45.123456 IP 192.168.1.1.54321 > 8.8.8.8.53: 12345+ A? google.com. yahoo.com. (29)",
-			expectedDomain: "google.com",
-			shouldAdd:      true,
+			name:   "Tunnels",
+			config: Config{Promiscuous: true, Tunnels: true},
+			expected: []string{"-n", "-i", "eth0", "-U", "-w", "-",
+				"(port 53) or (" + packet.TunnelFilter + ") or (vlan and ((port 53) or (vlan and (port 53))))"},
 		},
 	}
-	
+
 	for _, tc := range testCases {
 		suite.Run(tc.name, func() {
-			// Clear queue before each test
-			suite.queue.Get()
-			
-			// Simulate processing the line (extracted logic for testing)
-			line := tc.line
-			if line != "" && strings.Contains(line, "IP") && 
-			   (strings.Contains(line, "A?") || strings.Contains(line, "AAAA?")) {
-				for _, field := range strings.Fields(line) {
-					if strings.HasSuffix(field, ".") {
-						field = strings.TrimSuffix(field, ".")
-						if utils.IsValidDomain(field) {
-							suite.queue.Add(field)
-							break // Only add first valid domain for testing
-						}
-					}
-				}
-			}
-			
-			if tc.shouldAdd {
-				domains := suite.queue.Get()
-				suite.Contains(domains, tc.expectedDomain)
-			} else {
-				suite.Equal(0, suite.queue.Count())
-			}
+			suite.Equal(tc.expected, tc.config.Args("eth0"))
 		})
 	}
+	suite.Equal([]string{DefaultInterface}, Config{}.interfaces())
+	suite.Equal([]string{"eth0", "eth1"}, Config{Interfaces: []string{"eth0", "eth1"}}.interfaces())
+}
+
+func (suite *TCPDumpTestSuite) TestStop() {
+	ctx := context.Background()
+	err := suite.tcpdump.Stop(ctx)
+	suite.NoError(err)
+}
+
+func (suite *TCPDumpTestSuite) TestStopInterrupts() {
+	// A stand-in tcpdump that never writes a capture and runs until it's interrupted
+	dir := suite.T().TempDir()
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, "tcpdump"), []byte("#!/bin/sh\nexec sleep 60\n"), 0o755))
+	suite.T().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tcpdump := NewTCPDump(suite.queue, suite.logger, Config{Interfaces: []string{"eth0", "eth1"}})
+	done := make(chan error, 1)
+	go func() {
+		done <- tcpdump.Start()
+	}()
+	// Give Start a moment to run both processes
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	suite.NoError(tcpdump.Stop(ctx))
+	select {
+	case err := <-done:
+		suite.NoError(err)
+	case <-time.After(time.Second):
+		suite.Fail("Start did not return after Stop")
+	}
 }
 
 func (suite *TCPDumpTestSuite) TestStartRequiresTCPDump() {
@@ -0,0 +1,161 @@
+package zeek
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+const (
+	DefaultLogFile = "/opt/zeek/logs/current/dns.log"
+)
+
+// jsonRecord is the subset of a JSON formatted dns.log entry we care about.
+type jsonRecord struct {
+	Client    string   `json:"id.orig_h"`
+	Query     string   `json:"query"`
+	QTypeName string   `json:"qtype_name"`
+	RCodeName string   `json:"rcode_name"`
+	Answers   []string `json:"answers"`
+}
+
+// Parser understands both the TSV dns.log, driven by its #fields header, and the JSON one.
+// It keeps the header state between lines, so every file needs its own Parser.
+type Parser struct {
+	separator    string
+	setSeparator string
+	unsetField   string
+	emptyField   string
+	fields       map[string]int
+}
+
+func (p *Parser) ParseLine(line string) []types.Observation {
+	if strings.HasPrefix(line, "{") {
+		return p.parseJSON(line)
+	}
+	if strings.HasPrefix(line, "#") {
+		p.parseHeader(line)
+		return nil
+	}
+	return p.parseTSV(line)
+}
+
+func (p *Parser) parseHeader(line string) {
+	// #separator is always space separated, the rest of the header uses the separator itself
+	if value, ok := strings.CutPrefix(line, "#separator "); ok {
+		p.separator = unescape(value)
+		return
+	}
+	parts := strings.Split(line, p.separator)
+	switch parts[0] {
+	case "#set_separator":
+		if len(parts) > 1 {
+			p.setSeparator = parts[1]
+		}
+	case "#unset_field":
+		if len(parts) > 1 {
+			p.unsetField = parts[1]
+		}
+	case "#empty_field":
+		if len(parts) > 1 {
+			p.emptyField = parts[1]
+		}
+	case "#fields":
+		p.fields = make(map[string]int, len(parts)-1)
+		for i, name := range parts[1:] {
+			p.fields[name] = i
+		}
+	}
+}
+
+func (p *Parser) parseTSV(line string) []types.Observation {
+	if p.fields == nil {
+		return nil
+	}
+	values := strings.Split(line, p.separator)
+	query := p.value(values, "query")
+	if query == "" {
+		return nil
+	}
+	observation := types.Observation{
+		Query:  query,
+		QType:  p.value(values, "qtype_name"),
+		RCode:  p.value(values, "rcode_name"),
+		Client: p.value(values, "id.orig_h"),
+	}
+	if answers := p.value(values, "answers"); answers != "" {
+		observation.Answers = hostAnswers(strings.Split(answers, p.setSeparator))
+	}
+	return []types.Observation{observation}
+}
+
+// value returns the named column, mapping unset and empty markers to "".
+func (p *Parser) value(values []string, name string) string {
+	idx, ok := p.fields[name]
+	if !ok || idx >= len(values) {
+		return ""
+	}
+	value := values[idx]
+	if value == p.unsetField || value == p.emptyField {
+		return ""
+	}
+	return value
+}
+
+func (p *Parser) parseJSON(line string) []types.Observation {
+	var record jsonRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.Query == "" {
+		return nil
+	}
+	return []types.Observation{{
+		Query:   record.Query,
+		QType:   record.QTypeName,
+		RCode:   record.RCodeName,
+		Client:  record.Client,
+		Answers: hostAnswers(record.Answers),
+	}}
+}
+
+// hostAnswers drops answers that cannot be a name or an address, e.g. TXT strings.
+func hostAnswers(answers []string) []string {
+	result := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		if answer == "" || strings.ContainsAny(answer, " \t") {
+			continue
+		}
+		result = append(result, answer)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// unescape decodes the \xNN notation Zeek uses in its #separator header.
+func unescape(value string) string {
+	if hex, ok := strings.CutPrefix(value, `\x`); ok {
+		if b, err := strconv.ParseUint(hex, 16, 8); err == nil {
+			return string(rune(b))
+		}
+	}
+	return value
+}
+
+func NewParser() *Parser {
+	return &Parser{
+		separator:    "\t",
+		setSeparator: ",",
+		unsetField:   "-",
+		emptyField:   "(empty)",
+	}
+}
+
+func NewZeekLog(queue *models.DomainQueue, logger zerolog.Logger, logFile string) sources.Source {
+	return logtail.NewLogTail(queue, logger, "Zeek", logFile, NewParser().ParseLine)
+}
@@ -0,0 +1,152 @@
+package zeek
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/tb0hdan/pdns-sensor/pkg/models"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources"
+	"github.com/tb0hdan/pdns-sensor/pkg/sources/logtail"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+type MockCache struct {
+	data map[string]interface{}
+	mu   sync.RWMutex
+}
+
+func NewMockCache() *MockCache {
+	return &MockCache{
+		data: make(map[string]interface{}),
+	}
+}
+
+func (c *MockCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.data[key]
+	return val, ok
+}
+
+func (c *MockCache) SetEx(key string, value interface{}, expires int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+var tsvHeader = []string{
+	`#separator \x09`,
+	"#set_separator\t,",
+	"#empty_field\t(empty)",
+	"#unset_field\t-",
+	"#path\tdns",
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\ttrans_id\trtt\tquery\tqclass\tqclass_name\tqtype\tqtype_name\trcode\trcode_name\tAA\tTC\tRD\tRA\tZ\tanswers\tTTLs\trejected",
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tcount\tinterval\tstring\tcount\tstring\tcount\tstring\tcount\tstring\tbool\tbool\tbool\tbool\tcount\tvector[string]\tvector[interval]\tbool",
+}
+
+func tsvLine(values ...string) string {
+	return strings.Join(values, "\t")
+}
+
+type ZeekTestSuite struct {
+	suite.Suite
+	queue  *models.DomainQueue
+	logger zerolog.Logger
+}
+
+func (suite *ZeekTestSuite) SetupTest() {
+	suite.logger = zerolog.New(os.Stderr).Level(zerolog.ErrorLevel)
+	suite.queue = models.NewDomainQueue(NewMockCache(), 3600)
+}
+
+func (suite *ZeekTestSuite) TestNewZeekLog() {
+	source := NewZeekLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.NotNil(source)
+
+	_, ok := source.(*logtail.LogTail)
+	suite.True(ok)
+}
+
+func (suite *ZeekTestSuite) TestParseTSV() {
+	parser := NewParser()
+	for _, line := range tsvHeader {
+		suite.Nil(parser.ParseLine(line))
+	}
+
+	observations := parser.ParseLine(tsvLine("1700000000.000000", "CAbc", "192.168.1.10", "53211", "8.8.8.8", "53", "udp",
+		"1234", "0.01", "www.example.com", "1", "C_INTERNET", "1", "A", "0", "NOERROR", "F", "F", "T", "T", "0",
+		"cdn.example.net,93.184.216.34", "60.000000,60.000000", "F"))
+	suite.Equal([]types.Observation{{
+		Query:   "www.example.com",
+		QType:   "A",
+		RCode:   "NOERROR",
+		Client:  "192.168.1.10",
+		Answers: []string{"cdn.example.net", "93.184.216.34"},
+	}}, observations)
+
+	observations = parser.ParseLine(tsvLine("1700000000.000000", "CAbd", "192.168.1.10", "53212", "8.8.8.8", "53", "udp",
+		"1235", "-", "missing.example.com", "1", "C_INTERNET", "28", "AAAA", "3", "NXDOMAIN", "F", "F", "T", "T", "0",
+		"-", "-", "F"))
+	suite.Equal([]types.Observation{{
+		Query:  "missing.example.com",
+		QType:  "AAAA",
+		RCode:  "NXDOMAIN",
+		Client: "192.168.1.10",
+	}}, observations)
+}
+
+func (suite *ZeekTestSuite) TestParseTSVWithoutHeader() {
+	parser := NewParser()
+	suite.Nil(parser.ParseLine(tsvLine("1700000000.000000", "CAbc", "192.168.1.10", "www.example.com")))
+}
+
+func (suite *ZeekTestSuite) TestParseTSVUnsetQuery() {
+	parser := NewParser()
+	for _, line := range tsvHeader {
+		parser.ParseLine(line)
+	}
+	suite.Nil(parser.ParseLine(tsvLine("1700000000.000000", "CAbc", "192.168.1.10", "53211", "8.8.8.8", "53", "udp",
+		"1234", "-", "-", "-", "-", "-", "-", "-", "-", "F", "F", "F", "F", "0", "-", "-", "F")))
+}
+
+func (suite *ZeekTestSuite) TestParseJSON() {
+	parser := NewParser()
+	line := `{"ts":1700000000.0,"uid":"CAbc","id.orig_h":"192.168.1.10","id.orig_p":53211,"id.resp_h":"8.8.8.8",` +
+		`"id.resp_p":53,"proto":"udp","query":"www.example.org","qtype_name":"A","rcode_name":"NOERROR",` +
+		`"answers":["www.example.org.cdn.net","192.0.2.1","v=spf1 -all"]}`
+
+	suite.Equal([]types.Observation{{
+		Query:   "www.example.org",
+		QType:   "A",
+		RCode:   "NOERROR",
+		Client:  "192.168.1.10",
+		Answers: []string{"www.example.org.cdn.net", "192.0.2.1"},
+	}}, parser.ParseLine(line))
+	suite.Nil(parser.ParseLine(`{"ts":1700000000.0,"uid":"CAbc"}`))
+	suite.Nil(parser.ParseLine(`{"broken"`))
+}
+
+func (suite *ZeekTestSuite) TestProcessAddsDomains() {
+	source := NewZeekLog(suite.queue, suite.logger, DefaultLogFile).(*logtail.LogTail)
+	for _, line := range tsvHeader {
+		source.Process(line)
+	}
+	source.Process(tsvLine("1700000000.000000", "CAbc", "192.168.1.10", "53211", "8.8.8.8", "53", "udp",
+		"1234", "0.01", "www.example.com", "1", "C_INTERNET", "1", "A", "0", "NOERROR", "F", "F", "T", "T", "0",
+		"cdn.example.net,93.184.216.34", "60.000000,60.000000", "F"))
+
+	suite.ElementsMatch([]string{"www.example.com", "cdn.example.net"}, suite.queue.Get())
+}
+
+func (suite *ZeekTestSuite) TestInterfaceCompliance() {
+	var _ sources.Source = NewZeekLog(suite.queue, suite.logger, DefaultLogFile)
+	suite.True(true, "Zeek log source implements sources.Source interface")
+}
+
+func TestZeekTestSuite(t *testing.T) {
+	suite.Run(t, new(ZeekTestSuite))
+}
@@ -16,8 +16,18 @@ type Submitter struct {
 func (s *Submitter) QueueSubmitter(q *models.DomainQueue) {
 	const maxBatchSize = 1024
 	tick := time.NewTicker(60 * time.Second)
+	var lost uint64
 	for range tick.C {
 		domains := q.Get()
+		stats := q.Stats()
+		if stats.Dropped+stats.Evicted > lost {
+			lost = stats.Dropped + stats.Evicted
+			s.logger.Warn().Int("queued", stats.Queued).Int("spilled", stats.Spilled).Uint64("dropped", stats.Dropped).
+				Uint64("evicted", stats.Evicted).Uint64("spill_errors", stats.SpillErrors).Msg("Domain queue overflowed")
+		}
+		if stats.Rejected != nil {
+			s.logger.Debug().Interface("rejected", stats.Rejected).Msg("Rejected domains")
+		}
 		if len(domains) == 0 {
 			continue
 		}
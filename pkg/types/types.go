@@ -1,5 +1,34 @@
 package types
 
+import (
+	"net"
+	"strings"
+)
+
 type PassiveDNSRequest struct {
 	Domains []string `json:"domains"`
 }
+
+// Observation is a single DNS query and/or response reported by a source.
+type Observation struct {
+	Query   string   `json:"query"`
+	QType   string   `json:"qtype,omitempty"`
+	RCode   string   `json:"rcode,omitempty"`
+	Client  string   `json:"client,omitempty"`
+	Answers []string `json:"answers,omitempty"`
+}
+
+// Names returns the query name and every answer that is a host name rather than an address.
+func (o Observation) Names() []string {
+	names := make([]string, 0, 1+len(o.Answers))
+	if o.Query != "" {
+		names = append(names, strings.TrimSuffix(o.Query, "."))
+	}
+	for _, answer := range o.Answers {
+		if answer == "" || net.ParseIP(answer) != nil {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(answer, "."))
+	}
+	return names
+}
@@ -1,29 +1,84 @@
 package utils
 
-import (
-	"regexp"
-	"strings"
+import "strings"
+
+const (
+	// MaxDomainLength is the longest name in presentation format without the root dot, 255 bytes in wire format.
+	MaxDomainLength = 253
+	// MaxLabelLength is the longest label allowed by RFC 1035.
+	MaxLabelLength = 63
 )
 
+// IsDomain reports whether domain is a syntactically valid host or service name, in either case and
+// without the trailing root dot. Labels are 1-63 letters, digits and hyphens that don't start or end
+// with a hyphen. A label other than the TLD may start with an underscore, for SRV, DMARC and DKIM
+// names like _sip._tcp.example.com. There must be at least two labels and the TLD must have two or
+// more characters and not be numeric, which also rules out IPv4 literals. It doesn't allocate.
 func IsDomain(domain string) bool {
-	reg := regexp.MustCompile(`(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9][a-z0-9-]{0,61}[a-z0-9]`)
-	return reg.MatchString(domain)
+	if len(domain) > MaxDomainLength {
+		return false
+	}
+	labels := 0
+	start := 0
+	for i := 0; i <= len(domain); i++ {
+		if i < len(domain) && domain[i] != '.' {
+			continue
+		}
+		if !isLabel(domain[start:i]) {
+			return false
+		}
+		labels++
+		start = i + 1
+	}
+	return labels >= 2 && isTLD(domain[strings.LastIndexByte(domain, '.')+1:])
 }
 
-func IsValidDomain(domain string) bool {
-	// Sanity checks for domain length and structure
-	if len(domain) < 3 || len(domain) > 253 {
+// isLabel checks a single label, an underscore is only allowed as its first character.
+func isLabel(label string) bool {
+	if len(label) == 0 || len(label) > MaxLabelLength {
 		return false
 	}
-	//
-	if strings.HasSuffix(domain, ".local") || strings.HasSuffix(domain, ".localhost") {
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		switch {
+		case isLetter(c), c >= '0' && c <= '9', c == '-':
+		case c == '_' && i == 0 && len(label) > 1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isTLD checks the last label on top of isLabel, it must have a letter and no underscore.
+func isTLD(label string) bool {
+	if len(label) < 2 || label[0] == '_' {
 		return false
 	}
-	// Check for dot
-	parts := strings.Split(domain, ".")
-	if len(parts) < 2 {
+	for i := 0; i < len(label); i++ {
+		if isLetter(label[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// hasSuffixFold is strings.HasSuffix ignoring ASCII case.
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
+
+// IsValidDomain reports whether domain is worth submitting, a valid name outside the local-only TLDs.
+func IsValidDomain(domain string) bool {
+	if hasSuffixFold(domain, ".local") || hasSuffixFold(domain, ".localhost") {
 		return false
 	}
-	//
 	return IsDomain(domain)
 }
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DNSTestSuite struct {
+	suite.Suite
+}
+
+func (suite *DNSTestSuite) TestIsValidDomain() {
+	for domain, valid := range map[string]bool{
+		"example.com":                    true,
+		"www.example.com":                true,
+		"WWW.Example.COM":                true,
+		"a.co":                           true,
+		"xn--80ak6aa92e.com":             true,
+		"my-host.example.com":            true,
+		"123.example.com":                true,
+		"1.2.3.4.in-addr.arpa":           true,
+		"_sip._tcp.example.com":          true,
+		"_dmarc.example.com":             true,
+		"s1._domainkey.example.com":      true,
+		"example.xn--p1ai":               true,
+		"example.c0m":                    true,
+		"":                               false,
+		"com":                            false,
+		"localhost":                      false,
+		"printer.local":                  false,
+		"app.LOCALHOST":                  false,
+		"example.com.":                   false,
+		".example.com":                   false,
+		"www..example.com":               false,
+		"foo bar.example.com!!":          false,
+		"with space.example.com":         false,
+		"example.com/path":               false,
+		"-example.com":                   false,
+		"example-.com":                   false,
+		"www.example.com-":               false,
+		"my_host.example.com":            false,
+		"_.example.com":                  false,
+		"example._com":                   false,
+		"example.c":                      false,
+		"example.123":                    false,
+		"192.168.1.1":                    false,
+		"2001:db8::1":                    false,
+		"[2001:db8::1]":                  false,
+		"пример.com":                     false,
+		strings.Repeat("a", 63) + ".com": true,
+		strings.Repeat("a", 64) + ".com": false,
+	} {
+		suite.Equal(valid, IsValidDomain(domain), domain)
+	}
+}
+
+func (suite *DNSTestSuite) TestMaxDomainLength() {
+	label := strings.Repeat("a", 61)
+	// Four 61 character labels and dots plus the 5 character TLD make 253
+	longest := strings.Repeat(label+".", 4) + "b.com"
+	suite.Len(longest, MaxDomainLength)
+	suite.True(IsValidDomain(longest))
+	suite.False(IsValidDomain("a" + longest))
+}
+
+func (suite *DNSTestSuite) TestNoAllocations() {
+	allocs := testing.AllocsPerRun(100, func() {
+		IsValidDomain("_sip._tcp.www.Example.com")
+		IsValidDomain("foo bar.example.com!!")
+		IsValidDomain("printer.local")
+	})
+	suite.Zero(allocs)
+}
+
+func TestDNSTestSuite(t *testing.T) {
+	suite.Run(t, new(DNSTestSuite))
+}
+
+// referenceIsDomain is a slow but obvious version of IsDomain to fuzz against.
+func referenceIsDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(domain) > MaxDomainLength || len(labels) < 2 {
+		return false
+	}
+	for i, label := range labels {
+		tld := i == len(labels)-1
+		if len(label) == 0 || len(label) > MaxLabelLength ||
+			strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		body := label
+		if !tld && len(label) > 1 {
+			body = strings.TrimPrefix(label, "_")
+		}
+		if strings.Trim(body, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-") != "" {
+			return false
+		}
+		if tld && (len(label) < 2 || !strings.ContainsAny(strings.ToLower(label), "abcdefghijklmnopqrstuvwxyz")) {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzIsValidDomain(f *testing.F) {
+	for _, seed := range []string{
+		"example.com", "_dmarc.example.com", "foo bar.example.com!!", "192.168.1.1", "::1",
+		"example.com.", "a..b", "-a.com", "printer.local", "xn--80ak6aa92e.com", strings.Repeat("a.", 127) + "co",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, domain string) {
+		valid := IsValidDomain(domain)
+		if isDomain := IsDomain(domain); isDomain != referenceIsDomain(domain) {
+			t.Fatalf("IsDomain(%q) = %v, reference disagrees", domain, isDomain)
+		}
+		if !valid {
+			return
+		}
+		if _, err := netip.ParseAddr(domain); err == nil {
+			t.Fatalf("IP literal %q accepted", domain)
+		}
+		if strings.HasSuffix(strings.ToLower(domain), ".local") || strings.HasSuffix(strings.ToLower(domain), ".localhost") {
+			t.Fatalf("local name %q accepted", domain)
+		}
+	})
+}
+
+func BenchmarkIsValidDomain(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		IsValidDomain("_sip._tcp.www.example.com")
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"github.com/google/gopacket/layers"
+	"github.com/tb0hdan/pdns-sensor/pkg/types"
+)
+
+var responseCodes = map[layers.DNSResponseCode]string{
+	layers.DNSResponseCodeNoErr:    "NOERROR",
+	layers.DNSResponseCodeFormErr:  "FORMERR",
+	layers.DNSResponseCodeServFail: "SERVFAIL",
+	layers.DNSResponseCodeNXDomain: "NXDOMAIN",
+	layers.DNSResponseCodeNotImp:   "NOTIMP",
+	layers.DNSResponseCodeRefused:  "REFUSED",
+}
+
+// DNSObservations converts a decoded DNS message into one observation per question.
+// Answers are only filled in for responses and carry addresses and host name rdata.
+func DNSObservations(msg *layers.DNS, client string) []types.Observation {
+	var (
+		rcode   string
+		answers []string
+	)
+	if msg.QR {
+		rcode = responseCodes[msg.ResponseCode]
+		answers = dnsAnswers(msg.Answers)
+	}
+	observations := make([]types.Observation, 0, len(msg.Questions))
+	for _, question := range msg.Questions {
+		observations = append(observations, types.Observation{
+			Query:   string(question.Name),
+			QType:   question.Type.String(),
+			RCode:   rcode,
+			Client:  client,
+			Answers: answers,
+		})
+	}
+	return observations
+}
+
+func dnsAnswers(records []layers.DNSResourceRecord) []string {
+	var answers []string
+	for _, record := range records {
+		switch record.Type {
+		case layers.DNSTypeA, layers.DNSTypeAAAA:
+			if record.IP != nil {
+				answers = append(answers, record.IP.String())
+			}
+		case layers.DNSTypeCNAME:
+			answers = append(answers, string(record.CNAME))
+		case layers.DNSTypeNS:
+			answers = append(answers, string(record.NS))
+		case layers.DNSTypePTR:
+			answers = append(answers, string(record.PTR))
+		case layers.DNSTypeMX:
+			answers = append(answers, string(record.MX.Name))
+		case layers.DNSTypeSRV:
+			answers = append(answers, string(record.SRV.Name))
+		}
+	}
+	return answers
+}
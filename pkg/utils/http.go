@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// HTTPMethods are the request methods recognised when looking for HTTP requests in traffic and logs.
+var HTTPMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"DELETE":  true,
+	"CONNECT": true,
+	"OPTIONS": true,
+	"TRACE":   true,
+	"PATCH":   true,
+}
+
+// HostFromRequestTarget returns the destination host of an HTTP request target, see RFC 9112 section 3.2.
+// Only the authority form used by CONNECT and the absolute form sent to forward proxies name a host,
+// for origin form targets like "/index.html" and IP literals it returns "".
+func HostFromRequestTarget(method, target string) string {
+	var host string
+	switch {
+	case strings.EqualFold(method, "CONNECT"):
+		host = StripPort(target)
+	case strings.Contains(target, "://"):
+		u, err := url.Parse(target)
+		if err != nil {
+			return ""
+		}
+		host = strings.ToLower(u.Hostname())
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
+
+// StripPort removes an optional port and IPv6 brackets from a host, e.g. the value of a Host header.
+func StripPort(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+	}
+	return strings.ToLower(host)
+}
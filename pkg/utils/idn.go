@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrIDNADisallowedRune = errors.New("disallowed rune")
+	ErrIDNAInvalidLabel   = errors.New("invalid label")
+)
+
+// idnaProfile is UTS#46 lookup processing without the STD3 and hyphen checks, so _dmarc and
+// r3---sn names survive it. IsDomain checks the ASCII result afterwards.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+	idna.CheckHyphens(false),
+	idna.VerifyDNSLength(true),
+)
+
+// IsIDN reports whether domain has non-ASCII characters or a label starting with xn--, in either case.
+func IsIDN(domain string) bool {
+	for i := 0; i < len(domain); i++ {
+		if domain[i] >= 0x80 {
+			return true
+		}
+		if (i == 0 || domain[i-1] == '.') && i+4 <= len(domain) &&
+			domain[i]|0x20 == 'x' && domain[i+1]|0x20 == 'n' && domain[i+2] == '-' && domain[i+3] == '-' {
+			return true
+		}
+	}
+	return false
+}
+
+// ToASCII returns the canonical lowercase A-label form of domain. Plain ASCII names are only
+// lowercased, IDNs go through UTS#46 processing, which also checks that xn-- labels decode.
+func ToASCII(domain string) (string, error) {
+	if !IsIDN(domain) {
+		return strings.ToLower(domain), nil
+	}
+	ascii, err := idnaProfile.ToASCII(domain)
+	if err != nil {
+		return "", idnaError(err)
+	}
+	return ascii, nil
+}
+
+// ToUnicode returns the U-label form of an A-label domain.
+func ToUnicode(domain string) (string, error) {
+	unicode, err := idnaProfile.ToUnicode(domain)
+	if err != nil {
+		return "", idnaError(err)
+	}
+	return unicode, nil
+}
+
+// idnaError sorts idna errors, which are unexported types, into the two sentinel errors.
+func idnaError(err error) error {
+	if strings.HasPrefix(err.Error(), "idna: disallowed rune") {
+		return fmt.Errorf("%w: %w", ErrIDNADisallowedRune, err)
+	}
+	return fmt.Errorf("%w: %w", ErrIDNAInvalidLabel, err)
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type IDNTestSuite struct {
+	suite.Suite
+}
+
+func (suite *IDNTestSuite) TestIsIDN() {
+	for domain, idn := range map[string]bool{
+		"example.com":            false,
+		"r3---sn-abc.goog.com":   false,
+		"fooxn--bar.com":         false,
+		"xn--80ak6aa92e.com":     true,
+		"www.XN--80ak6aa92e.com": true,
+		"пример.com":             true,
+		"bücher.example":         true,
+	} {
+		suite.Equal(idn, IsIDN(domain), domain)
+	}
+}
+
+func (suite *IDNTestSuite) TestToASCII() {
+	for domain, ascii := range map[string]string{
+		"Example.COM":            "example.com",
+		"пример.com":             "xn--e1afmkfd.com",
+		"ПРИМЕР.com":             "xn--e1afmkfd.com",
+		"xn--e1afmkfd.com":       "xn--e1afmkfd.com",
+		"XN--E1AFMKFD.COM":       "xn--e1afmkfd.com",
+		"bücher.example":         "xn--bcher-kva.example",
+		"faß.de":                 "xn--fa-hia.de", // Nontransitional, ß is kept
+		"example。com":            "example.com",   // Ideographic full stop
+		"_dmarc.bücher.example":  "_dmarc.xn--bcher-kva.example",
+		"r3---sn-abc.bücher.com": "r3---sn-abc.xn--bcher-kva.com",
+	} {
+		result, err := ToASCII(domain)
+		suite.NoError(err, domain)
+		suite.Equal(ascii, result, domain)
+	}
+}
+
+func (suite *IDNTestSuite) TestToASCIIErrors() {
+	for domain, expected := range map[string]error{
+		"xn--zz.com":        ErrIDNAInvalidLabel,   // Bad punycode
+		"exam\u0085ple.com": ErrIDNADisallowedRune, // C1 control
+		"a\u200db.com":      ErrIDNAInvalidLabel,   // Joiner outside its context
+		"\u0627b.com":       ErrIDNAInvalidLabel,   // Mixed direction label
+		"bad\ufffdutf8.com": ErrIDNADisallowedRune, // Replacement character
+	} {
+		_, err := ToASCII(domain)
+		suite.ErrorIs(err, expected, domain)
+	}
+}
+
+func (suite *IDNTestSuite) TestToUnicode() {
+	unicode, err := ToUnicode("www.xn--e1afmkfd.com")
+	suite.NoError(err)
+	suite.Equal("www.пример.com", unicode)
+	_, err = ToUnicode("xn--zz.com")
+	suite.ErrorIs(err, ErrIDNAInvalidLabel)
+}
+
+func TestIDNTestSuite(t *testing.T) {
+	suite.Run(t, new(IDNTestSuite))
+}
@@ -2,8 +2,11 @@ package utils
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -27,3 +30,20 @@ func Run(logger zerolog.Logger, sourceList []sources.Source) {
 		}
 	}
 }
+
+// ParsePorts parses a comma separated list of port numbers, an empty list gives no ports.
+func ParsePorts(list string) ([]uint16, error) {
+	var ports []uint16
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(field, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		ports = append(ports, uint16(port))
+	}
+	return ports, nil
+}